@@ -0,0 +1,263 @@
+package goflat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrPathNotFound = errors.New("path not found")
+
+// `Get` returns the value found at a flattened key of a decoded JSON document,
+// reading the key with the configured Prefix, Separator and KeyStyle.
+func Get(doc interface{}, key string, config ...FlattenerConfig) (interface{}, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	path, err := parseKey(key, cfg)
+	if err != nil {
+		return nil, err
+	}
+	value, err := getPath(doc, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, key)
+	}
+	return value, nil
+}
+
+// `Set` stores value at a flattened key of a decoded JSON document, creating
+// the missing objects and arrays on the way, and returns the updated document.
+// Numeric segments create arrays, which are grown with nulls as needed.
+func Set(doc interface{}, key string, value interface{}, config ...FlattenerConfig) (interface{}, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	path, err := parseKey(key, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result, err := setPath(doc, path, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, key)
+	}
+	return result, nil
+}
+
+// `Delete` removes the value at a flattened key of a decoded JSON document and
+// returns the updated document; array elements after a removed one are
+// shifted down.
+func Delete(doc interface{}, key string, config ...FlattenerConfig) (interface{}, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	path, err := parseKey(key, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result, err := deletePath(doc, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, key)
+	}
+	return result, nil
+}
+
+// `GetJSON` returns the value found at a flattened key of a JSON document.
+func GetJSON(data []byte, key string, config ...FlattenerConfig) (interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, newParseError(data, err)
+	}
+	return Get(doc, key, config...)
+}
+
+// `SetJSON` stores value at a flattened key of a JSON document and returns the
+// updated document; empty data is read as a null document.
+func SetJSON(data []byte, key string, value interface{}, config ...FlattenerConfig) ([]byte, error) {
+	var doc interface{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, newParseError(data, err)
+		}
+	}
+	result, err := Set(doc, key, value, config...)
+	if err != nil {
+		return nil, err
+	}
+	return marshalDocument(result)
+}
+
+// `DeleteJSON` removes the value at a flattened key of a JSON document and
+// returns the updated document.
+func DeleteJSON(data []byte, key string, config ...FlattenerConfig) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, newParseError(data, err)
+	}
+	result, err := Delete(doc, key, config...)
+	if err != nil {
+		return nil, err
+	}
+	return marshalDocument(result)
+}
+
+// `marshalDocument` encodes an updated document.
+func marshalDocument(doc interface{}) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, newParseError(nil, err)
+	}
+	return data, nil
+}
+
+// `arrayIndex` returns the array index of a segment; names are accepted when
+// they are numeric so dotted and bracket keys address arrays alike. Identity
+// segments read from a key have no index.
+func arrayIndex(segment pathSegment) (int, bool) {
+	if segment.identity != "" {
+		return segment.index, segment.index >= 0
+	}
+	if segment.isIndex {
+		return segment.index, true
+	}
+	return parseIndex(segment.name)
+}
+
+// `elementIndex` returns the index of the array element addressed by a
+// segment: identity segments select the first element whose identity field
+// holds the segment value, like ArrayIdentity does when flattening.
+func elementIndex(arr []interface{}, segment pathSegment) (int, bool) {
+	if segment.identity == "" {
+		return arrayIndex(segment)
+	}
+	for i, elem := range arr {
+		if value, ok := identityValue(reflect.ValueOf(elem), segment.identity); ok && value == segment.name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// `getPath` returns the value found at path.
+func getPath(doc interface{}, path []pathSegment) (interface{}, error) {
+	for _, segment := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[segment.name]
+			if !ok || segment.identity != "" {
+				return nil, ErrPathNotFound
+			}
+			doc = value
+		case []interface{}:
+			index, ok := elementIndex(v, segment)
+			if !ok || index >= len(v) {
+				return nil, ErrPathNotFound
+			}
+			doc = v[index]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// `setPath` stores value at path and returns the updated document, since
+// arrays are reallocated when they grow. Identity segments that match no
+// element append a new object holding the identity field.
+func setPath(doc interface{}, path []pathSegment, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	segment := path[0]
+	if doc == nil {
+		// Missing containers are created following the segment type.
+		if segment.isIndex {
+			doc = []interface{}{}
+		} else {
+			doc = map[string]interface{}{}
+		}
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if segment.identity != "" {
+			break
+		}
+		child, err := setPath(v[segment.name], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[segment.name] = child
+		return v, nil
+	case []interface{}:
+		index, ok := elementIndex(v, segment)
+		if !ok && segment.identity != "" {
+			index = len(v)
+			v = append(v, map[string]interface{}{segment.identity: segment.name})
+		} else if !ok {
+			return nil, fmt.Errorf("%w: %q is not an array index", ErrKeyConflict, segment.name)
+		}
+		if index >= len(v)+maxArrayGap {
+			return nil, fmt.Errorf("%w: %d", ErrIndexOutOfRange, index)
+		}
+		for len(v) <= index {
+			v = append(v, nil)
+		}
+		child, err := setPath(v[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = child
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: cannot set %q on a %s", ErrKeyConflict, segment.name, valueType(doc))
+}
+
+// `deletePath` removes the value at path and returns the updated document.
+func deletePath(doc interface{}, path []pathSegment) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	segment := path[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[segment.name]
+		if !ok || segment.identity != "" {
+			return nil, ErrPathNotFound
+		}
+		if len(path) == 1 {
+			delete(v, segment.name)
+			return v, nil
+		}
+		child, err := deletePath(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[segment.name] = child
+		return v, nil
+	case []interface{}:
+		index, ok := elementIndex(v, segment)
+		if !ok || index >= len(v) {
+			return nil, ErrPathNotFound
+		}
+		if len(path) == 1 {
+			return append(v[:index], v[index+1:]...), nil
+		}
+		child, err := deletePath(v[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[index] = child
+		return v, nil
+	}
+	return nil, ErrPathNotFound
+}
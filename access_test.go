@@ -0,0 +1,135 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetSetDelete(t *testing.T) {
+	data := []byte(`{"InlinePolicies": [{"Statement": [{"Effect": "Allow"}, {"Effect": "Deny"}]}], "profile": {"name": "jane"}}`)
+
+	effect, err := GetJSON(data, "InlinePolicies.0.Statement.1.Effect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if effect != "Deny" {
+		t.Errorf("mismatch, got: %v, expected: Deny", effect)
+	}
+	if _, err := GetJSON(data, "InlinePolicies.1.Statement"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("expected ErrPathNotFound, got: %v", err)
+	}
+
+	updated, err := SetJSON(data, "profile~team", "Platform", FlattenerConfig{Separator: "~"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err = SetJSON(updated, "profile.roles.1.name", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err = DeleteJSON(updated, "InlinePolicies.0.Statement.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"InlinePolicies":[{"Statement":[{"Effect":"Deny"}]}],"profile":{"name":"jane","roles":[null,{"name":"admin"}],"team":"Platform"}}`
+	if string(updated) != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", updated, expected)
+	}
+
+	created, err := SetJSON(nil, `["a.b"][0]`, true, FlattenerConfig{Separator: ".", KeyStyle: KeyStyleBracket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"a.b":[true]}`; string(created) != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", created, expected)
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	doc := map[string]interface{}{"a": "x", "b": []interface{}{}}
+
+	tests := []struct {
+		key      string
+		expected error
+	}{
+		{key: "a.c", expected: ErrKeyConflict},
+		{key: "b.c", expected: ErrKeyConflict},
+		{key: "b.5000", expected: ErrIndexOutOfRange},
+	}
+	for _, test := range tests {
+		if _, err := Set(doc, test.key, 1); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got: %v", test.key, test.expected, err)
+		}
+	}
+
+	if _, err := Delete(doc, "c"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("expected ErrPathNotFound, got: %v", err)
+	}
+	root, err := Set(doc, "", "scalar")
+	if err != nil || !reflect.DeepEqual(root, "scalar") {
+		t.Errorf("unexpected root replacement: %v, %v", root, err)
+	}
+}
+
+func TestGetSetDeleteIdentity(t *testing.T) {
+	data := []byte(`{"Statement": [{"Sid": "AllowS3", "Effect": "Allow"}, {"Sid": "a.b", "Effect": "Deny"}]}`)
+
+	keys := []struct {
+		key    string
+		config FlattenerConfig
+	}{
+		{key: "Statement[Sid=AllowS3].Effect", config: FlattenerConfig{Separator: "."}},
+		{key: "Statement[Sid=AllowS3].Effect", config: FlattenerConfig{Separator: ".", KeyStyle: KeyStyleBracket}},
+		{key: "$.Statement[?(@.Sid=='AllowS3')].Effect", config: FlattenerConfig{KeyStyle: KeyStyleJSONPath}},
+	}
+	for _, test := range keys {
+		effect, err := GetJSON(data, test.key, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if effect != "Allow" {
+			t.Errorf("%s: mismatch, got: %v, expected: Allow", test.key, effect)
+		}
+	}
+	if effect, err := GetJSON(data, `Statement[Sid="a.b"].Effect`); err != nil || effect != "Deny" {
+		t.Errorf("unexpected quoted identity: %v, %v", effect, err)
+	}
+	if _, err := GetJSON(data, "Statement[Sid=Missing].Effect"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("expected ErrPathNotFound, got: %v", err)
+	}
+
+	updated, err := SetJSON(data, "Statement[Sid=AllowS3].Effect", "Deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err = SetJSON(updated, "Statement[Sid=AllowEC2].Effect", "Allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err = DeleteJSON(updated, `Statement[Sid="a.b"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Statement":[{"Effect":"Deny","Sid":"AllowS3"},{"Effect":"Allow","Sid":"AllowEC2"}]}`
+	if string(updated) != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", updated, expected)
+	}
+
+	if _, err := KeyToPointer("Statement[Sid=AllowS3].Effect"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got: %v", err)
+	}
+
+	flat := map[string]interface{}{"Statement[Sid=AllowS3].Effect": "Allow", "Statement.1.Effect": "Deny"}
+	got, err := Unflatten(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := map[string]interface{}{"Statement": []interface{}{
+		map[string]interface{}{"Sid": "AllowS3", "Effect": "Allow"},
+		map[string]interface{}{"Effect": "Deny"},
+	}}
+	if !reflect.DeepEqual(got, nested) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, nested)
+	}
+}
@@ -0,0 +1,107 @@
+package goflat
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// `ArrayMode` selects how arrays are flattened.
+type ArrayMode int
+
+const (
+	// `ArrayIndex` flattens each element under its index: `Action.0`.
+	ArrayIndex ArrayMode = iota
+	// `ArrayKeep` stores the whole array as a single leaf.
+	ArrayKeep
+	// `ArrayJoin` stores arrays of scalars as a single string joined with the
+	// ArrayDelimiter (a comma by default).
+	ArrayJoin
+	// `ArraySet` stores each scalar element as a key set to true:
+	// `Action.s3:GetObject`, so the order of the elements does not matter.
+	// With KeyStyleDotted, arrays holding a value that contains the Separator
+	// are flattened by index instead, as are arrays holding a redacted value;
+	// RedactDrop leaves such values out.
+	ArraySet
+)
+
+// `collapseArray` flattens an array following the Keep, Join and Set modes;
+// it returns false when the array must be flattened by index instead.
+func (f *flattener) collapseArray(path []pathSegment, arr reflect.Value) bool {
+	switch f.config.ArrayMode {
+	case ArrayKeep:
+		if !f.omit(arr) {
+			f.leaf(path, arr.Interface())
+		}
+		return true
+	case ArrayJoin, ArraySet:
+		values := make([]string, arr.Len())
+		for i := range values {
+			value, ok := scalarString(arr.Index(i))
+			if !ok {
+				// Join and Set only apply to arrays of scalars.
+				return false
+			}
+			values[i] = value
+		}
+
+		if f.config.ArrayMode == ArrayJoin {
+			delimiter := f.config.ArrayDelimiter
+			if delimiter == "" {
+				delimiter = ","
+			}
+			if !f.omit(arr) {
+				f.leaf(path, strings.Join(values, delimiter))
+			}
+			return true
+		}
+
+		if f.config.KeyStyle == KeyStyleDotted && f.config.Separator != "" {
+			for _, value := range values {
+				if strings.Contains(value, f.config.Separator) {
+					// Dotted keys cannot tell such values from nested keys;
+					// the other styles quote or escape them.
+					return false
+				}
+			}
+		}
+		redacted := make([]bool, len(values))
+		for i, value := range values {
+			// Values become keys, which redaction would leave in clear.
+			redacted[i] = f.redactor.matches(path, value)
+			if redacted[i] && f.config.RedactMode != RedactDrop {
+				return false
+			}
+		}
+		seen := make(map[string]bool, len(values))
+		for i, value := range values {
+			if !seen[value] && !redacted[i] && !f.stopped {
+				seen[value] = true
+				f.leaf(append(path, nameSegment(value)), true)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// `scalarString` formats a string, number or bool array element.
+func scalarString(val reflect.Value) (string, bool) {
+	for (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		return val.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(val.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(val.Float(), 'f', -1, val.Type().Bits()), true
+	}
+	return "", false
+}
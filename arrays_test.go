@@ -0,0 +1,121 @@
+package goflat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArrayMode(t *testing.T) {
+	input := `{"Statement": [{"Effect": "Allow", "Action": ["s3:PutObject", "s3:GetObject", "s3:PutObject"], "Port": [80, 443]}]}`
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:   "Keep",
+			config: FlattenerConfig{Separator: ".", ArrayMode: ArrayKeep},
+			expected: map[string]interface{}{
+				"Statement": []interface{}{map[string]interface{}{
+					"Effect": "Allow",
+					"Action": []interface{}{"s3:PutObject", "s3:GetObject", "s3:PutObject"},
+					"Port":   []interface{}{80.0, 443.0},
+				}},
+			},
+		},
+		{
+			name:   "Join",
+			config: FlattenerConfig{Separator: ".", ArrayMode: ArrayJoin, ArrayDelimiter: "|"},
+			expected: map[string]interface{}{
+				"Statement.0.Effect": "Allow",
+				"Statement.0.Action": "s3:PutObject|s3:GetObject|s3:PutObject",
+				"Statement.0.Port":   "80|443",
+			},
+		},
+		{
+			name:   "Set",
+			config: FlattenerConfig{Separator: ".", ArrayMode: ArraySet},
+			expected: map[string]interface{}{
+				"Statement.0.Effect":              "Allow",
+				"Statement.0.Action.s3:PutObject": true,
+				"Statement.0.Action.s3:GetObject": true,
+				"Statement.0.Port.80":             true,
+				"Statement.0.Port.443":            true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FlatJSONToMap(input, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			streamed := make(map[string]interface{})
+			err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+				streamed[key] = value
+				return nil
+			}, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(streamed, test.expected) {
+				t.Errorf("stream mismatch, got: %v, expected: %v", streamed, test.expected)
+			}
+		})
+	}
+}
+
+func TestArraySetSeparator(t *testing.T) {
+	input := `{"Hosts": ["api.example.com", "db"], "Zones": ["eu", "us"]}`
+
+	got, err := FlatJSONToMap(input, FlattenerConfig{Separator: ".", ArrayMode: ArraySet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"Hosts.0":  "api.example.com",
+		"Hosts.1":  "db",
+		"Zones.eu": true,
+		"Zones.us": true,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	got, err = FlatJSONToMap(input, FlattenerConfig{Separator: ".", ArrayMode: ArraySet, KeyStyle: KeyStyleBracket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{
+		`Hosts["api.example.com"]`: true,
+		"Hosts.db":                 true,
+		"Zones.eu":                 true,
+		"Zones.us":                 true,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestArrayModeStruct(t *testing.T) {
+	input := struct {
+		Action []string
+		Ports  []int
+	}{
+		Action: []string{"s3:PutObject", "s3:GetObject"},
+		Ports:  []int{80, 443},
+	}
+
+	got := FlatStruct(input, FlattenerConfig{Separator: ".", ArrayMode: ArrayJoin})
+	expected := map[string]interface{}{"Action": "s3:PutObject,s3:GetObject", "Ports": "80,443"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
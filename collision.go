@@ -0,0 +1,115 @@
+package goflat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// `CollisionPolicy` selects how leaves flattened to the same key are resolved.
+type CollisionPolicy int
+
+const (
+	// `CollisionKeepLast` keeps the value flattened last.
+	CollisionKeepLast CollisionPolicy = iota
+	// `CollisionError` keeps the first value and reports a KeyCollisionError.
+	CollisionError
+	// `CollisionKeepFirst` keeps the value flattened first.
+	CollisionKeepFirst
+	// `CollisionSuffix` stores later values under `key#2`, `key#3`, ...
+	CollisionSuffix
+	// `CollisionCollect` merges all the values into a slice.
+	CollisionCollect
+)
+
+// `Collision` describes a flattened key produced by more than one value;
+// Paths holds the JSON Pointers of the source values in traversal order.
+type Collision struct {
+	Key   string
+	Paths []string
+}
+
+// `KeyCollisionError` is returned by the CollisionError policy.
+type KeyCollisionError struct {
+	Collision
+}
+
+func (e *KeyCollisionError) Error() string {
+	return fmt.Sprintf("key %q produced by %s", e.Key, strings.Join(e.Paths, ", "))
+}
+
+// `mapSink` stores flattened leaves in a map; source paths are only tracked
+// when collisions must be resolved or reported.
+type mapSink struct {
+	config    FlattenerConfig
+	result    map[string]interface{}
+	sources   map[string][]string
+	collided  []string
+	collected map[string]bool
+}
+
+// `newMapSink` returns an empty sink for the given configuration.
+func newMapSink(config FlattenerConfig) *mapSink {
+	sink := &mapSink{config: config, result: make(map[string]interface{})}
+	if config.CollisionPolicy != CollisionKeepLast || config.OnCollision != nil {
+		sink.sources = make(map[string][]string)
+		sink.collected = make(map[string]bool)
+	}
+	return sink
+}
+
+// `add` stores a leaf applying the collision policy.
+func (s *mapSink) add(key string, path []pathSegment, value interface{}) bool {
+	if s.sources == nil {
+		s.result[key] = value
+		return true
+	}
+
+	source := formatKey(path, FlattenerConfig{KeyStyle: KeyStylePointer})
+	paths, exists := s.sources[key]
+	s.sources[key] = append(paths, source)
+	if !exists {
+		s.result[key] = value
+		return true
+	}
+	if len(paths) == 1 {
+		s.collided = append(s.collided, key)
+	}
+
+	switch s.config.CollisionPolicy {
+	case CollisionKeepLast:
+		s.result[key] = value
+	case CollisionSuffix:
+		for n := len(paths) + 1; ; n++ {
+			suffixed := fmt.Sprintf("%s#%d", key, n)
+			if _, taken := s.sources[suffixed]; !taken {
+				s.sources[suffixed] = []string{source}
+				s.result[suffixed] = value
+				break
+			}
+		}
+	case CollisionCollect:
+		if s.collected[key] {
+			s.result[key] = append(s.result[key].([]interface{}), value)
+		} else {
+			s.result[key] = []interface{}{s.result[key], value}
+			s.collected[key] = true
+		}
+	}
+	return true
+}
+
+// `collisions` reports every collided key to OnCollision, and returns the
+// errors for the CollisionError policy.
+func (s *mapSink) collisions() []error {
+	var errs []error
+	for _, key := range s.collided {
+		collision := Collision{Key: key, Paths: s.sources[key]}
+		if s.config.OnCollision != nil {
+			s.config.OnCollision(collision)
+		}
+		if s.config.CollisionPolicy == CollisionError {
+			errs = append(errs, &KeyCollisionError{Collision: collision})
+		}
+	}
+	return errs
+}
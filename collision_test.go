@@ -0,0 +1,65 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCollisionPolicy(t *testing.T) {
+	input := `{"a.b": 1, "a": {"b": 2}, "a.b#2": 3}`
+
+	tests := []struct {
+		name     string
+		policy   CollisionPolicy
+		expected map[string]interface{}
+	}{
+		{name: "KeepLast", policy: CollisionKeepLast, expected: map[string]interface{}{"a.b": 1.0, "a.b#2": 3.0}},
+		{name: "KeepFirst", policy: CollisionKeepFirst, expected: map[string]interface{}{"a.b": 2.0, "a.b#2": 3.0}},
+		{name: "Suffix", policy: CollisionSuffix, expected: map[string]interface{}{"a.b": 2.0, "a.b#2": 1.0, "a.b#2#2": 3.0}},
+		{name: "Collect", policy: CollisionCollect, expected: map[string]interface{}{"a.b": []interface{}{2.0, 1.0}, "a.b#2": 3.0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var collisions []Collision
+			got, err := FlatJSONToMap(input, FlattenerConfig{
+				Separator:       ".",
+				CollisionPolicy: test.policy,
+				OnCollision:     func(c Collision) { collisions = append(collisions, c) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			expectedCollision := Collision{Key: "a.b", Paths: []string{"/a/b", "/a.b"}}
+			if test.policy == CollisionSuffix {
+				expectedCollision = Collision{Key: "a.b#2", Paths: []string{"/a.b", "/a.b#2"}}
+				collisions = collisions[1:]
+			}
+			if !reflect.DeepEqual(collisions, []Collision{expectedCollision}) {
+				t.Errorf("unexpected collisions: %v", collisions)
+			}
+		})
+	}
+}
+
+func TestCollisionError(t *testing.T) {
+	members := map[string]interface{}{"Name": "upper", "name": "lower"}
+	_, err := FlatStructE(members, FlattenerConfig{
+		Separator:       ".",
+		KeysToLower:     true,
+		CollisionPolicy: CollisionError,
+	})
+
+	var collisionErr *KeyCollisionError
+	if !errors.As(err, &collisionErr) {
+		t.Fatalf("expected KeyCollisionError, got: %v", err)
+	}
+	if collisionErr.Key != "name" || !reflect.DeepEqual(collisionErr.Paths, []string{"/Name", "/name"}) {
+		t.Errorf("unexpected collision: %+v", collisionErr.Collision)
+	}
+}
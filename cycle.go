@@ -0,0 +1,93 @@
+package goflat
+
+import (
+	"reflect"
+)
+
+// `CyclePolicy` selects how FlatStruct handles a pointer, map or slice found
+// again while flattening its own content.
+type CyclePolicy int
+
+const (
+	// `CycleError` leaves the value out and reports a PointerCycleError.
+	CycleError CyclePolicy = iota
+	// `CycleSkip` leaves the value out.
+	CycleSkip
+	// `CycleReference` stores a `$ref:` marker holding the key of the value
+	// already being flattened, `$ref:root` for the input itself.
+	CycleReference
+)
+
+// `visit` identifies a value referenced by a pointer, map or slice; the type
+// tells apart a struct from its first field and the length slices of the same
+// array.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// `enter` records val as being flattened at path and reports whether its
+// content must be walked; values already being flattened by an ancestor are
+// handled following the CyclePolicy. Every successful call must be followed
+// by a call to `leave`.
+func (f *flattener) enter(path []pathSegment, val reflect.Value) bool {
+	v, ok := visitOf(val)
+	if !ok {
+		return true
+	}
+	ancestor, found := f.visiting[v]
+	if !found {
+		if f.visiting == nil {
+			f.visiting = make(map[visit][]pathSegment)
+		}
+		f.visiting[v] = append([]pathSegment(nil), path...)
+		return true
+	}
+
+	ref := formatKey(ancestor, f.config)
+	if len(ancestor) == 0 {
+		ref = "root"
+	}
+	switch f.config.CyclePolicy {
+	case CycleError:
+		f.errs = append(f.errs, &PointerCycleError{Key: formatKey(path, f.config), Ref: ref, Type: val.Type()})
+	case CycleReference:
+		f.leaf(path, "$ref:"+ref)
+	}
+	return false
+}
+
+// `leave` forgets a value recorded by `enter`.
+func (f *flattener) leave(val reflect.Value) {
+	if v, ok := visitOf(val); ok {
+		delete(f.visiting, v)
+	}
+}
+
+// `visitOf` returns the visit of a pointer, map or slice, false when it is
+// nil or refers to no memory of its own, as pointers to zero-sized values
+// and empty slices may share their address.
+func visitOf(val reflect.Value) (visit, bool) {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() || val.Type().Elem().Size() == 0 {
+			return visit{}, false
+		}
+	case reflect.Map:
+		if val.IsNil() {
+			return visit{}, false
+		}
+	case reflect.Slice:
+		if val.Len() == 0 {
+			return visit{}, false
+		}
+	default:
+		return visit{}, false
+	}
+	v := visit{ptr: val.Pointer(), typ: val.Type()}
+	if val.Kind() == reflect.Slice {
+		v.len = val.Len()
+	}
+	return v, true
+}
@@ -0,0 +1,85 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Parent   *treeNode   `json:"parent,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func TestCyclePolicy(t *testing.T) {
+	root := &treeNode{Name: "root"}
+	child := &treeNode{Name: "child", Parent: root}
+	root.Children = []*treeNode{child}
+
+	tests := []struct {
+		name     string
+		policy   CyclePolicy
+		expected map[string]interface{}
+	}{
+		{
+			name:     "error",
+			policy:   CycleError,
+			expected: map[string]interface{}{"name": "root", "children.0.name": "child"},
+		},
+		{
+			name:     "skip",
+			policy:   CycleSkip,
+			expected: map[string]interface{}{"name": "root", "children.0.name": "child"},
+		},
+		{
+			name:     "reference",
+			policy:   CycleReference,
+			expected: map[string]interface{}{"name": "root", "children.0.name": "child", "children.0.parent": "$ref:root"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultConfiguration()
+			config.CyclePolicy = test.policy
+			got := FlatStruct(root, config)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			_, err := FlatStructE(root, config)
+			var cycleErr *PointerCycleError
+			if test.policy != CycleError {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &cycleErr) || cycleErr.Key != "children.0.parent" || cycleErr.Ref != "root" {
+				t.Errorf("expected a PointerCycleError, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestCycleReferenceKeys(t *testing.T) {
+	config := defaultConfiguration()
+	config.CyclePolicy = CycleReference
+
+	loop := map[string]interface{}{"name": "loop"}
+	loop["self"] = loop
+	got := FlatStruct(map[string]interface{}{"data": loop}, config)
+	expected := map[string]interface{}{"data.name": "loop", "data.self": "$ref:data"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	// Values shared by siblings are not cycles.
+	shared := &treeNode{Name: "shared"}
+	got = FlatStruct(struct {
+		A *treeNode `json:"a"`
+		B *treeNode `json:"b"`
+	}{A: shared, B: shared}, config)
+	expected = map[string]interface{}{"a.name": "shared", "b.name": "shared"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
@@ -0,0 +1,196 @@
+package goflat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// `ChangeKind` classifies the difference found at a flattened key.
+type ChangeKind int
+
+const (
+	// `ChangeAdded` marks a key only present in the new document.
+	ChangeAdded ChangeKind = iota
+	// `ChangeRemoved` marks a key only present in the old document.
+	ChangeRemoved
+	// `ChangeChanged` marks a key whose value changed keeping its type.
+	ChangeChanged
+	// `ChangeTypeChanged` marks a key whose value changed type, e.g. from a
+	// number to a string.
+	ChangeTypeChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeChanged:
+		return "changed"
+	case ChangeTypeChanged:
+		return "type-changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// `Change` is a difference between two flattened documents; Old is nil for
+// added keys and New is nil for removed ones.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  interface{}
+	New  interface{}
+}
+
+// `DiffConfig` holds configuration options for diffing. The embedded
+// FlattenerConfig flattens the documents given to DiffJSON and is used to
+// read the keys matched by IgnorePaths.
+type DiffConfig struct {
+	FlattenerConfig
+	// `IgnorePaths` lists patterns of keys left out of the diff, written with
+	// the Separator: `*` matches one key, `**` any number of keys.
+	IgnorePaths []string
+	// `Tolerance` is the largest difference between two numbers still
+	// considered equal.
+	Tolerance float64
+}
+
+// `defaultDiffConfiguration` returns a DiffConfig with default values.
+func defaultDiffConfiguration() DiffConfig {
+	return DiffConfig{
+		FlattenerConfig: defaultConfiguration(),
+		IgnorePaths:     nil,
+		Tolerance:       0,
+	}
+}
+
+// `Diff` compares two flattened maps and returns their differences sorted by
+// key. Invalid IgnorePaths patterns are skipped; use DiffJSON to detect them.
+func Diff(a, b map[string]interface{}, config ...DiffConfig) []Change {
+	cfg := defaultDiffConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	changes, _ := diffMaps(a, b, cfg)
+	return changes
+}
+
+// `DiffJSON` flattens two JSON strings with FlatJSONToMap and returns their
+// differences sorted by key.
+func DiffJSON(a, b string, config ...DiffConfig) ([]Change, error) {
+	cfg := defaultDiffConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	flatA, err := FlatJSONToMap(a, cfg.FlattenerConfig)
+	if err != nil {
+		return nil, err
+	}
+	flatB, err := FlatJSONToMap(b, cfg.FlattenerConfig)
+	if err != nil {
+		return nil, err
+	}
+	changes, errs := diffMaps(flatA, flatB, cfg)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return changes, nil
+}
+
+// `diffMaps` compares two flattened maps collecting the invalid patterns found.
+func diffMaps(a, b map[string]interface{}, config DiffConfig) ([]Change, []error) {
+	var errs []error
+	ignored := make([]pathPattern, 0, len(config.IgnorePaths))
+	for _, pattern := range config.IgnorePaths {
+		compiled, err := compilePattern(pattern, config.FlattenerConfig, false)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ignored = append(ignored, compiled)
+	}
+
+	keys := make(map[string]bool, len(a)+len(b))
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+
+	var changes []Change
+	for _, key := range sortedMapKeys(keys) {
+		if isIgnored(key, ignored, config.FlattenerConfig) {
+			continue
+		}
+		oldValue, inA := a[key]
+		newValue, inB := b[key]
+		switch {
+		case !inA:
+			changes = append(changes, Change{Path: key, Kind: ChangeAdded, New: newValue})
+		case !inB:
+			changes = append(changes, Change{Path: key, Kind: ChangeRemoved, Old: oldValue})
+		case valueType(oldValue) != valueType(newValue):
+			changes = append(changes, Change{Path: key, Kind: ChangeTypeChanged, Old: oldValue, New: newValue})
+		case !equalValues(oldValue, newValue, config.Tolerance):
+			changes = append(changes, Change{Path: key, Kind: ChangeChanged, Old: oldValue, New: newValue})
+		}
+	}
+	return changes, errs
+}
+
+// `isIgnored` reports whether a flattened key matches one of the patterns.
+func isIgnored(key string, patterns []pathPattern, config FlattenerConfig) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	path := keyPath(key, config)
+	for _, pattern := range patterns {
+		if pattern.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// `valueType` returns the JSON type of a flattened value.
+func valueType(value interface{}) string {
+	v := reflect.ValueOf(value)
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Ptr, reflect.Interface:
+		return "null"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return v.Kind().String()
+}
+
+// `equalValues` compares two flattened values of the same JSON type; numbers
+// are equal when they differ by at most tolerance.
+func equalValues(a, b interface{}, tolerance float64) bool {
+	if valueType(a) == "number" {
+		x, _ := toFloat64(a)
+		y, _ := toFloat64(b)
+		return x == y || math.Abs(x-y) <= tolerance
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,86 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := map[string]interface{}{
+		"Name":       "Admins",
+		"Count":      3,
+		"Ratio":      0.5,
+		"Active":     true,
+		"Tags.0":     "x",
+		"Meta.Owner": "jane",
+	}
+	b := map[string]interface{}{
+		"Name":       "Admins",
+		"Count":      3.0,
+		"Ratio":      0.5000001,
+		"Active":     "true",
+		"Tags.1":     "y",
+		"Meta.Owner": "john",
+	}
+
+	got := Diff(a, b, DiffConfig{
+		FlattenerConfig: FlattenerConfig{Separator: "."},
+		IgnorePaths:     []string{"Meta.*"},
+		Tolerance:       0.001,
+	})
+	expected := []Change{
+		{Path: "Active", Kind: ChangeTypeChanged, Old: true, New: "true"},
+		{Path: "Tags.0", Kind: ChangeRemoved, Old: "x"},
+		{Path: "Tags.1", Kind: ChangeAdded, New: "y"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %+v, expected: %+v", got, expected)
+	}
+
+	got = Diff(a, b)
+	if len(got) != 5 || got[1].Path != "Meta.Owner" || got[2].Path != "Ratio" || got[2].Kind != ChangeChanged {
+		t.Errorf("unexpected diff without options: %+v", got)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	a := `{"Statement": [{"Sid": "AllowS3", "Effect": "Allow"}]}`
+	b := `{"Statement": [{"Sid": "DenyAll", "Effect": "Deny"}, {"Sid": "AllowS3", "Effect": "Allow"}]}`
+	config := DiffConfig{FlattenerConfig: FlattenerConfig{Separator: ".", ArrayIdentity: map[string]string{"Statement": "Sid"}}}
+
+	got, err := DiffJSON(a, b, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Path: "Statement[Sid=DenyAll].Effect", Kind: ChangeAdded, New: "Deny"},
+		{Path: "Statement[Sid=DenyAll].Sid", Kind: ChangeAdded, New: "DenyAll"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %+v, expected: %+v", got, expected)
+	}
+
+	if _, err := DiffJSON(a, `{`, config); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("expected ErrInvalidType, got: %v", err)
+	}
+	config.IgnorePaths = []string{""}
+	if _, err := DiffJSON(a, b, config); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expected ErrInvalidPattern, got: %v", err)
+	}
+}
+
+func TestChangeKindString(t *testing.T) {
+	kinds := map[ChangeKind]string{
+		ChangeAdded:       "added",
+		ChangeRemoved:     "removed",
+		ChangeChanged:     "changed",
+		ChangeTypeChanged: "type-changed",
+		ChangeKind(9):     "ChangeKind(9)",
+	}
+	for kind, expected := range kinds {
+		if got := kind.String(); got != expected {
+			t.Errorf("mismatch, got: %s, expected: %s", got, expected)
+		}
+	}
+}
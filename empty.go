@@ -0,0 +1,81 @@
+package goflat
+
+import (
+	"reflect"
+)
+
+// `EmptyPolicy` is the set of kinds of empty values left out when OmitEmpty
+// is set; the zero value stands for DefaultEmptyPolicy. Null values are left
+// out by both OmitEmpty and OmitNil.
+type EmptyPolicy int
+
+const (
+	// `OmitZeroNumbers` leaves out numbers equal to 0.
+	OmitZeroNumbers EmptyPolicy = 1 << iota
+	// `OmitEmptyStrings` leaves out empty strings.
+	OmitEmptyStrings
+	// `OmitFalse` leaves out false booleans.
+	OmitFalse
+	// `OmitEmptySlices` leaves out empty slices, arrays and JSON arrays stored
+	// as a single leaf.
+	OmitEmptySlices
+	// `OmitEmptyMaps` leaves out empty maps and JSON objects stored as a
+	// single leaf.
+	OmitEmptyMaps
+	// `OmitZeroStructs` leaves out structs equal to their zero value, or whose
+	// IsZero method returns true, with all their fields.
+	OmitZeroStructs
+
+	// `DefaultEmptyPolicy` leaves out every empty value except false.
+	DefaultEmptyPolicy = OmitZeroNumbers | OmitEmptyStrings | OmitEmptySlices | OmitEmptyMaps | OmitZeroStructs
+)
+
+// `omit` reports whether a value is left out following OmitEmpty,
+// EmptyPolicy and OmitNil.
+func (f *flattener) omit(val reflect.Value) bool {
+	if isNilValue(val) {
+		return f.config.OmitNil || f.config.OmitEmpty
+	}
+	if !f.config.OmitEmpty {
+		return false
+	}
+
+	policy := f.config.EmptyPolicy
+	if policy == 0 {
+		policy = DefaultEmptyPolicy
+	}
+	switch val.Kind() {
+	case reflect.Bool:
+		return policy&OmitFalse != 0 && isZeroValue(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return policy&OmitZeroNumbers != 0 && isZeroValue(val)
+	case reflect.String:
+		return policy&OmitEmptyStrings != 0 && isZeroValue(val)
+	case reflect.Slice, reflect.Array:
+		return policy&OmitEmptySlices != 0 && val.Len() == 0
+	case reflect.Map:
+		return policy&OmitEmptyMaps != 0 && val.Len() == 0
+	case reflect.Struct:
+		return policy&OmitZeroStructs != 0 && isZeroValue(val)
+	}
+	return val.IsZero()
+}
+
+var isZeroerType = reflect.TypeOf((*interface{ IsZero() bool })(nil)).Elem()
+
+// `isZeroValue` reports whether a value is zero, calling its IsZero method
+// when it has one as the `omitzero` option of encoding/json does.
+func isZeroValue(val reflect.Value) bool {
+	if !val.IsValid() {
+		return true
+	}
+	if (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && val.IsNil() {
+		return true
+	}
+	if z, ok := implementer(val, isZeroerType); ok {
+		return z.(interface{ IsZero() bool }).IsZero()
+	}
+	return val.IsZero()
+}
@@ -0,0 +1,194 @@
+package goflat
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type window struct {
+	Start, End int
+}
+
+func (w window) IsZero() bool {
+	return w.End <= w.Start
+}
+
+func TestEmptyPolicy(t *testing.T) {
+	type Stats struct {
+		Count  int      `json:"count"`
+		Name   string   `json:"name"`
+		Active bool     `json:"active"`
+		Tags   []string `json:"tags"`
+	}
+	input := struct {
+		Stats Stats `json:"stats"`
+		Ratio float64
+	}{Stats: Stats{Tags: []string{}}}
+	jsonInput := `{"stats": {"count": 0, "name": "", "active": false, "tags": []}, "Ratio": 0}`
+
+	tests := []struct {
+		name     string
+		policy   EmptyPolicy
+		expected map[string]interface{}
+	}{
+		{
+			name:     "Default",
+			policy:   DefaultEmptyPolicy,
+			expected: map[string]interface{}{"stats.active": false},
+		},
+		{
+			name:   "KeepNumbers",
+			policy: OmitEmptyStrings | OmitFalse | OmitEmptySlices,
+			expected: map[string]interface{}{
+				"stats.count": 0.0,
+				"Ratio":       0.0,
+			},
+		},
+		{
+			name:   "KeepEmptySlicesAsLeaves",
+			policy: OmitZeroNumbers | OmitEmptyStrings,
+			expected: map[string]interface{}{
+				"stats.active": false,
+				"stats.tags":   "[]",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := FlattenerConfig{Separator: ".", OmitEmpty: true, OmitNil: true, EmptyPolicy: test.policy}
+			if test.name == "KeepEmptySlicesAsLeaves" {
+				config.MaxDepth = 2
+			}
+
+			got, err := FlatJSONToMap(jsonInput, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("JSON mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			// Struct numbers keep their Go type; compare them as JSON numbers.
+			structGot := FlatStruct(input, config)
+			for key, value := range structGot {
+				if n, err := toFloat64(value); err == nil && valueType(value) == "number" {
+					structGot[key] = n
+				}
+			}
+			if !reflect.DeepEqual(structGot, test.expected) {
+				t.Errorf("struct mismatch, got: %v, expected: %v", structGot, test.expected)
+			}
+		})
+	}
+}
+
+func TestOmitZero(t *testing.T) {
+	type Schedule struct {
+		Name    string `json:"name"`
+		Window  window `json:"window,omitzero"`
+		Backup  window `json:"backup"`
+		Retries int    `json:"retries,omitzero"`
+	}
+	input := Schedule{Name: "nightly", Window: window{Start: 5, End: 1}, Backup: window{Start: 1, End: 3}}
+
+	config := FlattenerConfig{Separator: ".", OmitEmpty: false}
+	got := FlatStruct(input, config)
+	expected := map[string]interface{}{
+		"name":         "nightly",
+		"backup.Start": 1,
+		"backup.End":   3,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	// Zero structs, according to IsZero, are left out by OmitZeroStructs.
+	input.Backup = window{Start: 3, End: 3}
+	got = FlatStruct(input, FlattenerConfig{Separator: ".", OmitEmpty: true, EmptyPolicy: OmitZeroStructs})
+	if !reflect.DeepEqual(got, map[string]interface{}{"name": "nightly"}) {
+		t.Errorf("mismatch, got: %v", got)
+	}
+}
+
+func TestEmptyContainers(t *testing.T) {
+	input := `{"credentials": {"password": {}, "provider": {"type": "IAM"}}, "tags": [], "groups": [[], {}]}`
+	config := FlattenerConfig{Separator: ".", OmitEmpty: true, OmitNil: true, EmptyContainers: true}
+	expected := map[string]interface{}{
+		"credentials.password":      map[string]interface{}{},
+		"credentials.provider.type": "IAM",
+		"tags":                      []interface{}{},
+		"groups.0":                  []interface{}{},
+		"groups.1":                  map[string]interface{}{},
+	}
+
+	got, err := FlatJSONToMap(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	streamed := make(map[string]interface{})
+	err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+		streamed[key] = value
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("stream mismatch, got: %v, expected: %v", streamed, expected)
+	}
+
+	flat, err := FlatJSON(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := UnflattenJSON(flat, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotData, expectedData interface{}
+	_ = json.Unmarshal([]byte(nested), &gotData)
+	_ = json.Unmarshal([]byte(input), &expectedData)
+	if !reflect.DeepEqual(gotData, expectedData) {
+		t.Errorf("round trip mismatch, got: %s, expected: %s", nested, input)
+	}
+}
+
+func TestEmptyContainersStruct(t *testing.T) {
+	type Account struct {
+		Labels  map[string]string `json:"labels"`
+		Roles   []string          `json:"roles"`
+		Aliases []string          `json:"aliases"`
+		Owner   string            `json:"owner"`
+	}
+	input := Account{Labels: map[string]string{}, Roles: []string{}, Owner: "jane"}
+	config := FlattenerConfig{Separator: ".", OmitEmpty: true, OmitNil: true, EmptyContainers: true}
+
+	got := FlatStruct(input, config)
+	expected := map[string]interface{}{
+		"labels": map[string]interface{}{},
+		"roles":  []interface{}{},
+		"owner":  "jane",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	var account Account
+	if err := UnflattenInto(got, &account, config); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(account, input) {
+		t.Errorf("mismatch, got: %#v, expected: %#v", account, input)
+	}
+
+	if _, err := Unflatten(map[string]interface{}{"a": []interface{}{}, "a.b": 1}, config); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
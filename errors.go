@@ -0,0 +1,143 @@
+package goflat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// `ParseError` describes a JSON input that cannot be parsed or encoded. The
+// position is set when it is known: Offset is the number of bytes read before
+// the failure, Line and Column are 1-based. It matches ErrInvalidType with
+// errors.Is, and io.ErrUnexpectedEOF when the input is truncated.
+type ParseError struct {
+	Offset int64
+	Line   int
+	Column int
+	Err    error
+
+	truncated bool
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%v at line %d, column %d (offset %d): %v", ErrInvalidType, e.Line, e.Column, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", ErrInvalidType, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrInvalidType || (target == io.ErrUnexpectedEOF && e.truncated)
+}
+
+// `newParseError` wraps an encoding/json error with its position in data.
+func newParseError(data []byte, err error) *ParseError {
+	parseErr := &ParseError{Err: err}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		parseErr.Offset = syntaxErr.Offset
+		parseErr.truncated = syntaxErr.Offset >= int64(len(data))
+	case errors.As(err, &typeErr):
+		parseErr.Offset = typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		parseErr.truncated = true
+		return parseErr
+	default:
+		return parseErr
+	}
+
+	offset := min(parseErr.Offset, int64(len(data)))
+	before := data[:offset]
+	parseErr.Line = bytes.Count(before, []byte("\n")) + 1
+	parseErr.Column = int(offset) - bytes.LastIndexByte(before, '\n') - 1
+	return parseErr
+}
+
+// `UnsupportedTypeError` is returned when a value of a kind that cannot be
+// flattened (channels, functions and unsafe pointers) is found.
+type UnsupportedTypeError struct {
+	Key  string
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported type %s at key %q", e.Type, e.Key)
+}
+
+// `NestedJSONError` is returned when a string that looks like a JSON object
+// or array cannot be parsed.
+type NestedJSONError struct {
+	Key string
+	Err error
+}
+
+func (e *NestedJSONError) Error() string {
+	return fmt.Sprintf("invalid nested JSON at key %q: %v", e.Key, e.Err)
+}
+
+func (e *NestedJSONError) Unwrap() error {
+	return e.Err
+}
+
+// `AssignError` describes a flattened key whose value cannot be assigned to
+// the target type.
+type AssignError struct {
+	Key   string
+	Value interface{}
+	Type  reflect.Type
+	Err   error
+}
+
+func (e *AssignError) Error() string {
+	msg := fmt.Sprintf("cannot assign %T %v to %s at key %q", e.Value, e.Value, e.Type, e.Key)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *AssignError) Unwrap() error {
+	return e.Err
+}
+
+// `MarshalerError` wraps the error returned by a FlatMarshaler, a
+// json.Marshaler or an encoding.TextMarshaler, or by a FlatHook when Type is
+// nil.
+type MarshalerError struct {
+	Key  string
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("error calling hook at key %q: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("error marshaling type %s at key %q: %v", e.Type, e.Key, e.Err)
+}
+
+func (e *MarshalerError) Unwrap() error {
+	return e.Err
+}
+
+// `PointerCycleError` is returned by the CycleError policy when a value is
+// found again inside itself; Ref is the key of the value being flattened.
+type PointerCycleError struct {
+	Key  string
+	Ref  string
+	Type reflect.Type
+}
+
+func (e *PointerCycleError) Error() string {
+	return fmt.Sprintf("cycle of type %s at key %q referencing %q", e.Type, e.Key, e.Ref)
+}
@@ -0,0 +1,141 @@
+package goflat
+
+import (
+	"reflect"
+)
+
+// `pathFilter` holds the compiled Include and Exclude patterns.
+type pathFilter struct {
+	include []pathPattern
+	exclude []pathPattern
+}
+
+// `compileFilter` compiles the Include and Exclude patterns of config.
+func compileFilter(config FlattenerConfig) (pathFilter, error) {
+	include, err := compilePatterns(config.Include, config, false)
+	if err != nil {
+		return pathFilter{}, err
+	}
+	exclude, err := compilePatterns(config.Exclude, config, false)
+	if err != nil {
+		return pathFilter{}, err
+	}
+	return pathFilter{include: include, exclude: exclude}, nil
+}
+
+// `prune` reports whether the subtree at path must not be visited: it is
+// excluded or cannot hold included leaves.
+func (p pathFilter) prune(path []pathSegment) bool {
+	if p.excluded(path) {
+		return true
+	}
+	if len(p.include) == 0 {
+		return false
+	}
+	for _, pattern := range p.include {
+		if pattern.overlaps(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// `selected` reports whether the leaf at path must be emitted: it is not
+// excluded and, when Include is set, it or one of its ancestors is included.
+func (p pathFilter) selected(path []pathSegment) bool {
+	if p.excluded(path) {
+		return false
+	}
+	if len(p.include) == 0 {
+		return true
+	}
+	for _, pattern := range p.include {
+		if pattern.matchesAncestor(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// `excluded` reports whether path matches an Exclude pattern.
+func (p pathFilter) excluded(path []pathSegment) bool {
+	for _, pattern := range p.exclude {
+		if pattern.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// `excludesBelow` reports whether an Exclude pattern may match a descendant
+// of path.
+func (p pathFilter) excludesBelow(path []pathSegment) bool {
+	for _, pattern := range p.exclude {
+		if pattern.overlaps(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// `scrub` applies Exclude and redaction to the descendants of a subtree
+// stored as a single leaf at path, as by MaxDepth, ArrayKeep or a
+// FlatMarshaler: when a pattern or a value detector may match below path the
+// subtree is replaced by its JSON copy without the excluded values and with
+// the redacted ones replaced. It returns false when the subtree must be
+// dropped.
+func (f *flattener) scrub(path []pathSegment, value interface{}) (interface{}, bool) {
+	if !isContainer(reflect.ValueOf(value)) || (!f.filter.excludesBelow(path) && !f.redactor.redactsBelow(path)) {
+		return value, true
+	}
+	copied, err := toJSONValue(value)
+	if err != nil {
+		// Never store a subtree that could not be filtered.
+		f.errs = append(f.errs, err)
+		return nil, false
+	}
+	return f.scrubValue(path, copied)
+}
+
+// `scrubValue` walks a JSON value dropping the excluded values and
+// redacting the leaves as `leaf` does.
+func (f *flattener) scrubValue(path []pathSegment, value interface{}) (interface{}, bool) {
+	if f.filter.excluded(path) {
+		return nil, false
+	}
+	if f.redactor.mode == RedactDrop && f.redactor.matches(path, nil) {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			if elem, ok := f.scrubValue(append(path[:len(path):len(path)], nameSegment(key)), elem); ok {
+				result[key] = elem
+			}
+		}
+		return result, true
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for i, elem := range v {
+			if elem, ok := f.scrubValue(append(path[:len(path):len(path)], indexSegment(i)), elem); ok {
+				result = append(result, elem)
+			}
+		}
+		return result, true
+	}
+	return f.redactor.redact(path, value)
+}
+
+// `isContainer` reports whether val holds a struct, a map, a slice or an
+// array, possibly behind pointers and interfaces.
+func isContainer(val reflect.Value) bool {
+	for (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && !val.IsNil() {
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package goflat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncludeExclude(t *testing.T) {
+	input := `{"id": 1, "_links": {"self": {"href": "/a"}}, "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"]}, {"Effect": "Deny", "Sid": "x"}]}`
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:   "Exclude",
+			config: FlattenerConfig{Separator: ".", Exclude: []string{"_links", "Statement.*.Action"}},
+			expected: map[string]interface{}{
+				"id":                 1.0,
+				"Statement.0.Effect": "Allow",
+				"Statement.1.Effect": "Deny",
+				"Statement.1.Sid":    "x",
+			},
+		},
+		{
+			name:   "Include",
+			config: FlattenerConfig{Separator: ".", Include: []string{"Statement.*.Effect", "Statement[0].Action"}},
+			expected: map[string]interface{}{
+				"Statement.0.Effect":   "Allow",
+				"Statement.0.Action.0": "s3:GetObject",
+				"Statement.1.Effect":   "Deny",
+			},
+		},
+		{
+			name:   "IncludeAndExclude",
+			config: FlattenerConfig{Separator: ".", Include: []string{"Statement"}, Exclude: []string{"**.Effect"}},
+			expected: map[string]interface{}{
+				"Statement.0.Action.0": "s3:GetObject",
+				"Statement.1.Sid":      "x",
+			},
+		},
+		{
+			name:   "Anchored",
+			config: FlattenerConfig{Separator: ".", Include: []string{"id", "Sid"}, Exclude: []string{"Effect"}},
+			expected: map[string]interface{}{
+				"id": 1.0,
+			},
+		},
+		{
+			name:   "ExcludeInsideMaxDepth",
+			config: FlattenerConfig{Separator: ".", MaxDepth: 1, Exclude: []string{"**.href", "**.Sid"}},
+			expected: map[string]interface{}{
+				"id":        1.0,
+				"_links":    `{"self":{}}`,
+				"Statement": `[{"Action":["s3:GetObject"],"Effect":"Allow"},{"Effect":"Deny"}]`,
+			},
+		},
+		{
+			name:   "ExcludeInsideArrayKeep",
+			config: FlattenerConfig{Separator: ".", ArrayMode: ArrayKeep, Exclude: []string{"Statement.*.Action", "Statement[1]"}},
+			expected: map[string]interface{}{
+				"id":               1.0,
+				"_links.self.href": "/a",
+				"Statement":        []interface{}{map[string]interface{}{"Effect": "Allow"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FlatJSONToMap(input, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			streamed := make(map[string]interface{})
+			err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+				streamed[key] = value
+				return nil
+			}, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(streamed, test.expected) {
+				t.Errorf("stream mismatch, got: %v, expected: %v", streamed, test.expected)
+			}
+		})
+	}
+}
+
+func TestExcludePrunesStruct(t *testing.T) {
+	input := struct {
+		Name     string
+		Internal struct {
+			Callback func()
+		}
+	}{Name: "x"}
+
+	// The excluded subtree holds a value that cannot be flattened.
+	got, err := FlatStructE(input, FlattenerConfig{Separator: ".", OmitNil: false, Exclude: []string{"Internal"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"Name": "x"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestExcludeRawRemainder(t *testing.T) {
+	type Profile struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	input := map[string]interface{}{"user": &Profile{Name: "a", Password: "hunter2"}}
+
+	got := FlatStruct(input, FlattenerConfig{Separator: ".", MaxDepth: 1, RawRemainder: true, Exclude: []string{"**.password"}})
+	expected := map[string]interface{}{"user": map[string]interface{}{"name": "a"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	got = FlatStruct(input, FlattenerConfig{Separator: ".", MaxDepth: 1, RawRemainder: true, Exclude: []string{"group.id"}})
+	expected = map[string]interface{}{"user": map[string]interface{}{"name": "a", "password": "hunter2"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestIncludeExcludeIdentity(t *testing.T) {
+	type Statement struct {
+		Sid    string
+		Effect string
+	}
+	input := `{"Statement": [{"Sid": "AllowS3", "Effect": "Allow"}, {"Sid": "a.b", "Effect": "Deny"}]}`
+	value := struct{ Statement []Statement }{Statement: []Statement{{Sid: "AllowS3", Effect: "Allow"}, {Sid: "a.b", Effect: "Deny"}}}
+	identity := map[string]string{"Statement": "Sid"}
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:     "Include",
+			config:   FlattenerConfig{Separator: ".", ArrayIdentity: identity, Include: []string{"Statement[Sid=AllowS3].Effect"}},
+			expected: map[string]interface{}{"Statement[Sid=AllowS3].Effect": "Allow"},
+		},
+		{
+			name:   "Exclude",
+			config: FlattenerConfig{Separator: ".", ArrayIdentity: identity, Exclude: []string{"Statement[Sid=Allow*].Effect", `Statement[Sid="a.b"].Sid`}},
+			expected: map[string]interface{}{
+				"Statement[Sid=AllowS3].Sid":  "AllowS3",
+				`Statement[Sid="a.b"].Effect`: "Deny",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FlatJSONToMap(input, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			streamed := make(map[string]interface{})
+			err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+				streamed[key] = value
+				return nil
+			}, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(streamed, test.expected) {
+				t.Errorf("stream mismatch, got: %v, expected: %v", streamed, test.expected)
+			}
+
+			if got := FlatStruct(value, test.config); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("struct mismatch, got: %v, expected: %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package goflat
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 var ErrInvalidType = errors.New("not a valid JSON input")
@@ -19,6 +22,70 @@ type FlattenerConfig struct {
 	OmitNil     bool
 	SortKeys    bool
 	KeysToLower bool
+	KeyStyle    KeyStyle
+	// `CollisionPolicy` resolves leaves flattened to the same key; OnCollision,
+	// if set, is called once for each collided key.
+	CollisionPolicy CollisionPolicy
+	OnCollision     func(Collision)
+	// `MaxDepth` limits the number of key segments; deeper subtrees are stored
+	// as a single leaf holding their compact JSON, or the nested value itself
+	// when RawRemainder is set. Go values are nested into maps and slices
+	// named as their flattened keys. Zero means no limit.
+	MaxDepth     int
+	RawRemainder bool
+	// `ArrayMode` selects how arrays are flattened; ArrayDelimiter is used by
+	// the ArrayJoin mode.
+	ArrayMode      ArrayMode
+	ArrayDelimiter string
+	// `ArrayIdentity` maps array path patterns to the field identifying their
+	// elements, e.g. `Statement` to `Sid`, so elements are keyed as
+	// `Statement[Sid=AllowS3]` instead of by index; elements without the field
+	// keep their index. A single-segment pattern matches at any depth.
+	ArrayIdentity map[string]string
+	// `Include` and `Exclude` are path patterns, written like ArrayIdentity
+	// ones but matching whole paths, e.g. `**.password` at any depth,
+	// filtering the leaves while walking: subtrees that are excluded, or
+	// cannot hold included leaves when Include is set, are never visited.
+	// Excluded values are also removed from subtrees stored as single leaves
+	// by MaxDepth or ArrayKeep.
+	Include []string
+	Exclude []string
+	// `RedactKeys` are path patterns, matched regardless of case, whose leaves
+	// and subtrees are redacted, e.g. `*password*` or `credentials.**`;
+	// string leaves matching one of RedactValues, such as DetectJWT, are
+	// redacted too. RedactMode selects the replacement: RedactMask (the
+	// default) writes RedactMask, RedactPseudonym an HMAC keyed with
+	// RedactKey and RedactDrop leaves the key out. Subtrees stored as single
+	// leaves, e.g. by MaxDepth, are redacted inside as well.
+	RedactKeys   []string
+	RedactValues []*regexp.Regexp
+	RedactMode   RedactMode
+	RedactMask   string
+	RedactKey    []byte
+	// `Hooks` maps path patterns to functions flattening the values found at
+	// the matching paths, as FlatMarshaler does for Go types; a single-segment
+	// pattern matches at any depth.
+	Hooks map[string]FlatHook
+	// `LeafInterfaces` selects the interfaces whose values are leaves holding
+	// their own encoding instead of being walked; zero means
+	// DefaultLeafInterfaces and LeafNone none of them. time.Time values are
+	// always leaves formatted with TimeFormat (RFC 3339 by default) and
+	// time.Duration ones follow DurationFormat.
+	LeafInterfaces LeafInterface
+	TimeFormat     string
+	DurationFormat DurationFormat
+	// `EmptyPolicy` selects the kinds of empty values left out by OmitEmpty;
+	// zero means DefaultEmptyPolicy.
+	EmptyPolicy EmptyPolicy
+	// `EmptyContainers` stores empty objects and arrays, and non-nil empty
+	// maps and slices, as leaves holding an empty map[string]interface{} or
+	// []interface{}, encoded as `{}` and `[]`, regardless of OmitEmpty;
+	// Unflatten rebuilds them.
+	EmptyContainers bool
+	// `CyclePolicy` selects how FlatStruct handles pointers, maps and slices
+	// referencing a value that contains them, e.g. a child pointing back to
+	// its parent.
+	CyclePolicy CyclePolicy
 }
 
 // `DefaultFlattenerConfig` returns a FlattenerConfig with default values.
@@ -30,51 +97,69 @@ func defaultConfiguration() FlattenerConfig {
 		OmitNil:     true,
 		SortKeys:    false,
 		KeysToLower: false,
+		KeyStyle:    KeyStyleDotted,
+
+		CollisionPolicy: CollisionKeepLast,
+		MaxDepth:        0,
+		RawRemainder:    false,
+		ArrayMode:       ArrayIndex,
+		ArrayDelimiter:  ",",
+		ArrayIdentity:   nil,
+		Include:         nil,
+		Exclude:         nil,
+		RedactKeys:      nil,
+		RedactValues:    nil,
+		RedactMode:      RedactMask,
+		RedactMask:      "[REDACTED]",
+		RedactKey:       nil,
+		Hooks:           nil,
+		LeafInterfaces:  DefaultLeafInterfaces,
+		TimeFormat:      time.RFC3339Nano,
+		DurationFormat:  DurationNanoseconds,
+		EmptyPolicy:     DefaultEmptyPolicy,
+		EmptyContainers: false,
+		CyclePolicy:     CycleError,
 	}
 }
 
 // `FlatStruct` flattens a Go struct into a map with flattened keys.
+// Values that cannot be flattened are skipped; use FlatStructE to detect them.
 func FlatStruct(input interface{}, config ...FlattenerConfig) map[string]interface{} {
-	cfg := defaultConfiguration()
-	if len(config) > 0 {
-		cfg = config[0]
-	}
+	result, _ := flatStruct(input, config...)
+	return result
+}
 
-	result := make(map[string]interface{})
-	flattenFields(reflect.ValueOf(input), cfg.Prefix, result, cfg)
-	if cfg.SortKeys {
-		sortKeys(&result)
-	}
-	if cfg.KeysToLower {
-		keysToLower(&result)
+// `FlatStructE` flattens a Go struct into a map with flattened keys, returning
+// an error for values that cannot be flattened.
+func FlatStructE(input interface{}, config ...FlattenerConfig) (map[string]interface{}, error) {
+	result, errs := flatStruct(input, config...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
-	return result
+	return result, nil
 }
 
-// `FlatJSON` flattens a JSON string into a flattened JSON string.
-func FlatJSON(jsonStr string, config ...FlattenerConfig) (string, error) {
+// `flatStruct` flattens a Go struct collecting the errors found on the way.
+func flatStruct(input interface{}, config ...FlattenerConfig) (map[string]interface{}, []error) {
 	cfg := defaultConfiguration()
 	if len(config) > 0 {
 		cfg = config[0]
 	}
 
-	var data interface{}
-	err := json.Unmarshal([]byte(jsonStr), &data)
-	if err != nil {
-		return "", ErrInvalidType
-	}
+	return flattenToMap(cfg, func(f *flattener) {
+		f.flattenFields(reflect.ValueOf(input), nil)
+	})
+}
 
-	flattenedMap := make(map[string]interface{})
-	flatten(cfg.Prefix, data, flattenedMap, cfg)
-	if cfg.SortKeys {
-		sortKeys(&flattenedMap)
-	}
-	if cfg.KeysToLower {
-		keysToLower(&flattenedMap)
+// `FlatJSON` flattens a JSON string into a flattened JSON string.
+func FlatJSON(jsonStr string, config ...FlattenerConfig) (string, error) {
+	flattenedMap, err := FlatJSONToMap(jsonStr, config...)
+	if err != nil {
+		return "", err
 	}
 	flattenedJSON, err := json.Marshal(flattenedMap)
 	if err != nil {
-		return "", ErrInvalidType
+		return "", newParseError(nil, err)
 	}
 	return string(flattenedJSON), nil
 }
@@ -89,20 +174,45 @@ func FlatJSONToMap(jsonStr string, config ...FlattenerConfig) (map[string]interf
 	var data interface{}
 	err := json.Unmarshal([]byte(jsonStr), &data)
 	if err != nil {
-		return nil, ErrInvalidType
+		return nil, newParseError([]byte(jsonStr), err)
 	}
 
-	flattenedMap := make(map[string]interface{})
-	flatten(cfg.Prefix, data, flattenedMap, cfg)
-	if cfg.SortKeys {
-		sortKeys(&flattenedMap)
-	}
-	if cfg.KeysToLower {
-		keysToLower(&flattenedMap)
+	flattenedMap, errs := flattenToMap(cfg, func(f *flattener) {
+		f.flatten(nil, data)
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 	return flattenedMap, nil
 }
 
+// `flattenToMap` runs walk storing every leaf in a map, resolving key
+// collisions with the configured policy.
+func flattenToMap(config FlattenerConfig, walk func(f *flattener)) (map[string]interface{}, []error) {
+	sink := newMapSink(config)
+	f := newFlattener(config, sink.add)
+	if len(f.errs) > 0 {
+		// An invalid config could leave secrets unredacted; flatten nothing.
+		return sink.result, f.errs
+	}
+	walk(f)
+	errs := append(f.errs, sink.collisions()...)
+	if config.SortKeys {
+		sortKeys(&sink.result)
+	}
+	return sink.result, errs
+}
+
+// `sortedMapKeys` returns the keys of a map in lexical order.
+func sortedMapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // `sortKeys` sorts keys in the flattened structure.
 func sortKeys(result *map[string]interface{}) {
 	keys := make(map[string]string)
@@ -122,131 +232,377 @@ func sortKeys(result *map[string]interface{}) {
 	*result = sortedResult
 }
 
-// `flatten` flattens a nested structure into a map with flattened keys.
-func flatten(prefix string, value interface{}, result map[string]interface{}, config FlattenerConfig) {
+// `flattener` walks a value and passes each leaf, with the path it was found
+// at, to emit; emit returns false to stop the walk.
+type flattener struct {
+	config     FlattenerConfig
+	emit       func(key string, path []pathSegment, value interface{}) bool
+	identities []identityRule
+	filter     pathFilter
+	redactor   redactor
+	hooks      []hookRule
+	visiting   map[visit][]pathSegment
+	stopped    bool
+	errs       []error
+}
+
+// `newFlattener` returns a flattener for config; invalid ArrayIdentity,
+// Include, Exclude, RedactKeys and Hooks patterns are recorded as errors.
+func newFlattener(config FlattenerConfig, emit func(key string, path []pathSegment, value interface{}) bool) *flattener {
+	f := &flattener{config: config, emit: emit}
+	identities, err := compileIdentities(config)
+	if err != nil {
+		f.errs = append(f.errs, err)
+	}
+	f.identities = identities
+	f.filter, err = compileFilter(config)
+	if err != nil {
+		f.errs = append(f.errs, err)
+	}
+	f.redactor, err = compileRedactor(config)
+	if err != nil {
+		f.errs = append(f.errs, err)
+	}
+	f.hooks, err = compileHooks(config)
+	if err != nil {
+		f.errs = append(f.errs, err)
+	}
+	return f
+}
+
+// `leaf` emits a value with its full key.
+func (f *flattener) leaf(path []pathSegment, value interface{}) {
+	if f.stopped || !f.filter.selected(path) {
+		return
+	}
+	value, ok := f.scrub(path, value)
+	if !ok {
+		return
+	}
+	value, ok = f.redactor.redact(path, value)
+	if !ok {
+		return
+	}
+	key := formatKey(path, f.config)
+	if f.config.KeysToLower {
+		key = strings.ToLower(key)
+	}
+	f.stopped = !f.emit(key, path, value)
+}
+
+// `atMaxDepth` reports whether the path reached the configured MaxDepth.
+func (f *flattener) atMaxDepth(path []pathSegment) bool {
+	return f.config.MaxDepth > 0 && len(path) >= f.config.MaxDepth
+}
+
+// `remainder` emits a subtree below MaxDepth as a single leaf.
+func (f *flattener) remainder(path []pathSegment, value interface{}) {
+	if f.config.RawRemainder {
+		f.leaf(path, value)
+		return
+	}
+	value, ok := f.scrub(path, value)
+	if !ok {
+		return
+	}
+	compact, err := json.Marshal(value)
+	if err != nil {
+		f.errs = append(f.errs, newParseError(nil, err))
+		return
+	}
+	f.leaf(path, string(compact))
+}
+
+// `collect` walks a Go value at path without MaxDepth, with arrays by index,
+// and nests its leaves back into maps and slices, so subtrees stored as a
+// single leaf follow the same tags, omit rules, filters and redaction as the
+// flattened keys. It returns false when no leaf is left.
+func (f *flattener) collect(path []pathSegment, val reflect.Value) (interface{}, bool) {
+	root := &unflattenNode{indexed: true}
+	sub := *f
+	sub.config.MaxDepth = 0
+	sub.config.ArrayMode = ArrayIndex
+	sub.config.EmptyContainers = true
+	sub.errs = nil
+	sub.emit = func(key string, leafPath []pathSegment, value interface{}) bool {
+		segments := make([]pathSegment, 0, len(leafPath)-len(path))
+		for _, segment := range leafPath[len(path):] {
+			if segment.identity != "" {
+				segment = indexSegment(segment.index)
+			}
+			segments = append(segments, segment)
+		}
+		if err := root.insert(key, segments, value); err != nil {
+			sub.errs = append(sub.errs, err)
+		}
+		return true
+	}
+
+	// val is being flattened by the caller: let the walk enter it again.
+	f.leave(val)
+	sub.flattenFields(val, path)
+	f.enter(path, val)
+
+	f.errs = append(f.errs, sub.errs...)
+	if !root.leaf && root.empty == nil && len(root.children) == 0 {
+		return nil, false
+	}
+	return root.build(), true
+}
+
+// `flatten` flattens a nested structure into flattened keys.
+func (f *flattener) flatten(path []pathSegment, value interface{}) {
+	if f.filter.prune(path) {
+		return
+	}
+	if hook := f.hookAt(path); hook != nil {
+		f.marshal(path, nil, func(prefix string, emit func(string, interface{})) error {
+			return hook(prefix, value, emit)
+		}, f.flatten)
+		return
+	}
+	if f.atMaxDepth(path) {
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			if !f.omit(reflect.ValueOf(v)) {
+				f.remainder(path, v)
+			}
+			return
+		}
+	}
+
 	switch v := value.(type) {
 	case map[string]interface{}:
+		if len(v) == 0 && f.config.EmptyContainers {
+			f.leaf(path, map[string]interface{}{})
+			return
+		}
 		// For each key-value pair in the map, recursively flatten the nested structure.
-		for key, val := range v {
-			fullKey := key
-			if prefix != "" {
-				fullKey = prefix + config.Separator + key
+		for _, key := range sortedMapKeys(v) {
+			if f.stopped {
+				return
 			}
-			flatten(fullKey, val, result, config)
+			f.flatten(append(path, nameSegment(key)), v[key])
 		}
 	case []interface{}:
 		// For each element in the array, recursively flatten the nested structure.
-		flattenArray(prefix, v, result, config)
+		f.flattenArray(path, v)
 	default:
-		// If the value is neither a map nor an array, add it to the result map.
+		// If the value is neither a map nor an array, emit it.
 		// Optionally omitting empty or nil values based on the configuration.
-		val := reflect.ValueOf(v)
-		if (!config.OmitEmpty || !isEmptyValue(val)) && (!config.OmitNil || !isNilValue(val)) {
-			result[prefix] = v
+		if !f.omit(reflect.ValueOf(v)) {
+			f.leaf(path, v)
 		}
 	}
 }
 
-// `flattenArray` flattens an array into a map with flattened keys.
-func flattenArray(prefix string, arr []interface{}, result map[string]interface{}, config FlattenerConfig) {
+// `flattenArray` flattens an array into flattened keys.
+func (f *flattener) flattenArray(path []pathSegment, arr []interface{}) {
+	if len(arr) == 0 && f.config.EmptyContainers {
+		f.leaf(path, []interface{}{})
+		return
+	}
+	if f.collapseArray(path, reflect.ValueOf(arr)) {
+		return
+	}
+	segments := f.elementSegments(path, reflect.ValueOf(arr))
 	for i, v := range arr {
-		// Generate the full key for each element in the array.
-		fullKey := fmt.Sprintf("%s%s%s%d", config.Prefix, prefix, config.Separator, i)
-		// Remove leading separator if it's present.
-		if strings.Index(fullKey, config.Separator) == 0+len(config.Prefix) {
-			fullKey = fullKey[1:]
+		if f.stopped {
+			return
 		}
 		// Recursively flatten the nested structure for each array element.
-		flatten(fullKey, v, result, config)
+		f.flatten(append(path, segments[i]), v)
 	}
 }
 
-// `flattenFields` flattens fields of a struct into a map with flattened keys.
-func flattenFields(val reflect.Value, prefix string, result map[string]interface{}, config FlattenerConfig) {
-	typ := val.Type()
-	if val.Kind() == reflect.Ptr && !val.IsNil() {
+// `flattenFields` flattens fields of a struct into flattened keys, recording
+// an error for each value that cannot be flattened.
+func (f *flattener) flattenFields(val reflect.Value, path []pathSegment) {
+	if f.filter.prune(path) {
+		return
+	}
+	walk := func(path []pathSegment, v interface{}) {
+		f.flattenFields(reflect.ValueOf(v), path)
+	}
+	if hook := f.hookAt(path); hook != nil {
+		var value interface{}
+		if val.IsValid() && val.CanInterface() {
+			value = val.Interface()
+		}
+		f.marshal(path, nil, func(prefix string, emit func(string, interface{})) error {
+			return hook(prefix, value, emit)
+		}, walk)
+		return
+	}
+
+	// Pointers and interfaces are flattened as the value they refer to, unless
+	// one of them implements FlatMarshaler or is a leaf with its own encoding.
+	for {
+		if m, ok := flatMarshaler(val); ok {
+			f.marshal(path, val.Type(), m.FlattenInto, walk)
+			return
+		}
+		if f.marshalLeaf(path, val) {
+			return
+		}
+		if (val.Kind() != reflect.Ptr && val.Kind() != reflect.Interface) || val.IsNil() {
+			break
+		}
+		if val.Kind() == reflect.Ptr {
+			if !f.enter(path, val) {
+				return
+			}
+			defer f.leave(val)
+		}
 		val = val.Elem()
-		typ = val.Type()
+	}
+	if val.Kind() == reflect.Map || val.Kind() == reflect.Slice {
+		if !f.enter(path, val) {
+			return
+		}
+		defer f.leave(val)
+	}
+
+	if val.Kind() == reflect.Slice && isByteSlice(val.Type()) {
+		// Byte slices are base64 strings, as in encoding/json.
+		if val.IsNil() {
+			if !f.omit(val) {
+				f.leaf(path, nil)
+			}
+			return
+		}
+		encoded := base64.StdEncoding.EncodeToString(val.Bytes())
+		if !f.omit(reflect.ValueOf(encoded)) {
+			f.leaf(path, encoded)
+		}
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if f.atMaxDepth(path) {
+			switch {
+			case (val.Kind() == reflect.Map || val.Kind() == reflect.Slice) && val.IsNil():
+				// Nil maps and slices are JSON nulls.
+				if !f.omit(reflect.Value{}) {
+					f.leaf(path, nil)
+				}
+			case f.omit(val):
+			default:
+				if nested, ok := f.collect(path, val); ok {
+					f.remainder(path, nested)
+				}
+			}
+			return
+		}
 	}
 
 	switch val.Kind() {
 	case reflect.Struct:
+		if f.omit(val) {
+			// Zero structs are left out with all their fields.
+			return
+		}
 		// For each field in the struct, recursively flatten the nested structure.
-		for i := 0; i < val.NumField(); i++ {
-			field := val.Field(i)
-			fieldName := typ.Field(i).Name
-			if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
-				fullKey := prefix + fieldName
-				flattenArrayFields(fullKey, "", field, result, config)
-			} else if (!config.OmitEmpty || !isEmptyValue(field)) && (!config.OmitNil || !isNilValue(field)) {
-				// Recursively flatten the nested structure for each struct field.
-				flattenFields(field, prefix+fieldName+config.Separator, result, config)
+		// Embedded structs are promoted by `typeFields`.
+		for _, info := range typeFields(val.Type()) {
+			if f.stopped {
+				return
+			}
+			field, ok := fieldByIndex(val, info.index, false)
+			if !ok || (info.opts.omitEmpty && isOmitEmptyValue(field)) || (info.opts.omitZero && isZeroValue(field)) {
+				continue
+			}
+			if info.name == "" {
+				// Inline fields are flattened at the same level of their parent.
+				if !isNilValue(field) {
+					f.flattenFields(field, path)
+				}
+			} else {
+				f.flattenFields(field, append(path, nameSegment(info.name)))
 			}
 		}
 	case reflect.Map:
+		if val.Len() == 0 && !val.IsNil() && f.config.EmptyContainers {
+			f.leaf(path, map[string]interface{}{})
+			return
+		}
 		// For each key-value pair in the map, recursively flatten the nested structure.
+		keys := make(map[string]reflect.Value, val.Len())
 		for _, key := range val.MapKeys() {
-			field := val.MapIndex(key)
-			fieldName := key.String()
-			fullKey := prefix + fieldName
-			// Optionally omitting empty or nil values based on the configuration.
-			if (!config.OmitEmpty || !isEmptyValue(field)) && (!config.OmitNil || !isNilValue(field)) {
-				if field.Kind() == reflect.Struct {
-					// If the value is a struct, recursively flatten the nested structure.
-					flattenFields(field, fullKey+config.Separator, result, config)
-				} else if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
-					// If the value is a slice or array, flatten each element in the collection.
-					flattenArrayFields(fullKey, "", field, result, config)
-				} else {
-					// If the value is neither a struct nor a slice/array, add it to the result map.
-					result[fullKey] = field.Interface()
-				}
+			keys[fmt.Sprint(key.Interface())] = key
+		}
+		for _, fieldName := range sortedMapKeys(keys) {
+			if f.stopped {
+				return
 			}
+			f.flattenFields(val.MapIndex(keys[fieldName]), append(path, nameSegment(fieldName)))
 		}
+	case reflect.Slice, reflect.Array:
+		// For each element in the collection, recursively flatten the nested structure.
+		f.flattenArrayFields(path, val)
 	default:
-		// If the value is neither a struct nor a map, add it to the result map.
+		// If the value is neither a struct, a map nor a collection, emit it.
 		// Optionally omitting empty or nil values based on the configuration.
-		if (config.OmitEmpty || !isEmptyValue(val)) && (!config.OmitNil || !isNilValue(val)) && val.CanInterface() {
-			prefix = prefix[:len(prefix)-1]
-			// If `val` is a valid JSON likely this was *string; flat it
-			if js := isJSON(val.String()); js != nil {
-				flatMap, _ := FlatJSONToMap(val.String(), config)
-				flatten(prefix, flatMap, result, config)
+		if f.omit(val) {
+			break
+		}
+		switch val.Kind() {
+		case reflect.Invalid:
+			f.leaf(path, nil)
+		case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+			f.errs = append(f.errs, &UnsupportedTypeError{Key: formatKey(path, f.config), Type: val.Type()})
+		default:
+			data, ok, err := nestedJSON(val)
+			if err != nil {
+				// Keep the raw string when it only looks like JSON.
+				f.errs = append(f.errs, &NestedJSONError{Key: formatKey(path, f.config), Err: err})
+			}
+			if ok {
+				// If `val` is a JSON object or array likely this was *string; flat it
+				f.flatten(path, data)
 			} else {
-				result[prefix] = val.Interface()
+				f.leaf(path, val.Interface())
 			}
 		}
 	}
 }
 
-// `flattenArrayFields` flattens fields of an array into a map with flattened keys.
-func flattenArrayFields(prefix, fieldName string, field reflect.Value, result map[string]interface{}, config FlattenerConfig) {
-	for i := 0; i < field.Len(); i++ {
-		// Extract each element from the array and generate a key for it.
-		item := field.Index(i).Interface()
-		key := fmt.Sprintf("%s%s%d", prefix+fieldName+config.Separator, config.Separator, i)
-
-		if field.Index(i).Kind() == reflect.Ptr {
-			key = fmt.Sprintf("%s%d%s", prefix+fieldName+config.Separator, i, config.Separator)
-			flattenFields(field.Index(i), key, result, config)
-		} else {
-			// Optionally omitting empty or nil values based on the configuration.
-			val := reflect.ValueOf(item)
-			if (!config.OmitEmpty || !isEmptyValue(val)) && (!config.OmitNil || !isNilValue(val)) {
-				// Add the key-value pair to the result map.
-				result[key] = item
-			}
+// `flattenArrayFields` flattens the elements of a slice or array into flattened keys.
+func (f *flattener) flattenArrayFields(path []pathSegment, field reflect.Value) {
+	if field.Len() == 0 && (field.Kind() == reflect.Array || !field.IsNil()) && f.config.EmptyContainers {
+		f.leaf(path, []interface{}{})
+		return
+	}
+	if f.config.ArrayMode == ArrayKeep {
+		// Elements are stored as they would be flattened.
+		if f.omit(field) {
+			return
+		}
+		if nested, ok := f.collect(path, field); ok {
+			f.leaf(path, nested)
 		}
+		return
+	}
+	if f.collapseArray(path, field) {
+		return
+	}
+	segments := f.elementSegments(path, field)
+	for i := 0; i < field.Len() && !f.stopped; i++ {
+		// Recursively flatten the nested structure for each element.
+		f.flattenFields(field.Index(i), append(path, segments[i]))
 	}
 }
 
-// `keysToLower` return a map with all keys on lowercase
-func keysToLower(result *map[string]interface{}) {
-	new_result := make(map[string]interface{}, len(*result))
-	for k, v := range *result {
-		new_result[strings.ToLower(k)] = v
+// `isByteSlice` reports whether typ is a slice of bytes encoded by
+// encoding/json as a base64 string, that is whose elements do not implement
+// json.Marshaler or encoding.TextMarshaler.
+func isByteSlice(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Slice || typ.Elem().Kind() != reflect.Uint8 {
+		return false
 	}
-	*result = new_result
+	ptr := reflect.PointerTo(typ.Elem())
+	return !ptr.Implements(jsonMarshalerType) && !ptr.Implements(textMarshalerType)
 }
 
 // `isEmptyValue` checks if a reflect.Value is empty.
@@ -264,17 +620,48 @@ func isEmptyValue(field reflect.Value) bool {
 	return reflect.DeepEqual(field.Interface(), zero.Interface())
 }
 
+// `isOmitEmptyValue` checks if a reflect.Value is empty following the
+// `omitempty` rules of encoding/json.
+func isOmitEmptyValue(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return field.Len() == 0
+	case reflect.Bool:
+		return !field.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return field.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return field.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return field.IsNil()
+	}
+	return false
+}
+
 // `isNilValue` checks if a reflect.Value is nil.
 func isNilValue(field reflect.Value) bool {
-	// Check if the field is a pointer and is nil.
-	return field.Kind() == reflect.Ptr && field.IsNil()
+	// Check if the field is a JSON null, or a pointer or interface holding nil.
+	if !field.IsValid() {
+		return true
+	}
+	return (field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface) && field.IsNil()
 }
 
-// `jsJSON` checks if a string it's a valid JSON string.
-func isJSON(str string) json.RawMessage {
-	var js json.RawMessage
-	if err := json.Unmarshal([]byte(str), &js); err != nil {
-		return nil
+// `nestedJSON` decodes a string holding a JSON object or array; the error is
+// set when the string looks like JSON but cannot be parsed.
+func nestedJSON(val reflect.Value) (interface{}, bool, error) {
+	if val.Kind() != reflect.String {
+		return nil, false, nil
+	}
+	str := strings.TrimSpace(val.String())
+	if !strings.HasPrefix(str, "{") && !strings.HasPrefix(str, "[") {
+		return nil, false, nil
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(str), &data); err != nil {
+		return nil, false, newParseError([]byte(str), err)
 	}
-	return js
+	return data, true, nil
 }
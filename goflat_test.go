@@ -2,8 +2,12 @@ package goflat
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -530,3 +534,306 @@ func TestToLower(t *testing.T) {
 		t.Errorf("expected: %v\ngot: %v", expected, got)
 	}
 }
+
+func TestFlattenStructTags(t *testing.T) {
+	type AuthenticationProvider struct {
+		Name string `json:"name,omitempty"`
+		Type string `json:"type,omitempty"`
+	}
+
+	type Audit struct {
+		CreatedBy string `json:"createdBy"`
+	}
+
+	type UserCredentials struct {
+		Provider *AuthenticationProvider `json:"provider,omitempty"`
+		Secret   string                  `json:"secret" flat:"-"`
+		Retries  int                     `json:"retries,omitempty"`
+		Audit    *Audit                  `flat:",inline"`
+		Renamed  string                  `json:"old" flat:"new"`
+	}
+
+	type TaggedUser struct {
+		Credentials *UserCredentials `json:"credentials,omitempty"`
+		Status      string           `json:"status,omitempty"`
+		Ignored     string           `json:"-"`
+		Dash        int              `json:"-,"`
+	}
+
+	user := TaggedUser{
+		Credentials: &UserCredentials{
+			Provider: &AuthenticationProvider{Name: "IAM", Type: "IAM"},
+			Secret:   "hunter2",
+			Audit:    &Audit{CreatedBy: "admin"},
+			Renamed:  "x",
+		},
+		Status:  "ACTIVE",
+		Ignored: "ignored",
+		Dash:    7,
+	}
+
+	expected := map[string]interface{}{
+		"credentials.provider.name": "IAM",
+		"credentials.provider.type": "IAM",
+		"credentials.createdBy":     "admin",
+		"credentials.new":           "x",
+		"status":                    "ACTIVE",
+		"-":                         7,
+	}
+
+	got := FlatStruct(user, FlattenerConfig{Separator: "."})
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, got)
+	}
+
+	var back TaggedUser
+	if err := UnflattenInto(got, &back); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if back.Credentials.Audit.CreatedBy != "admin" || back.Credentials.Provider.Type != "IAM" || back.Credentials.Renamed != "x" || back.Dash != 7 {
+		t.Errorf("unflattened struct mismatch: %+v", back.Credentials)
+	}
+}
+
+func TestFlattenStructAndJSONKeysMatch(t *testing.T) {
+	type SubSub struct {
+		D int
+	}
+
+	type Sub struct {
+		A       int
+		B       string
+		C       []SubSub
+		Ptrs    []*SubSub
+		Nested  [][]string
+		Labels  map[string]SubSub
+		Any     interface{}
+		Fixed   [2]bool
+		Missing *SubSub
+		Bytes   []byte
+	}
+
+	input := Sub{
+		A:      3,
+		B:      "hello",
+		C:      []SubSub{{D: 10}, {D: 11}},
+		Ptrs:   []*SubSub{{D: 12}, nil},
+		Nested: [][]string{{"x", "y"}, {"z"}},
+		Labels: map[string]SubSub{"first": {D: 13}},
+		Any:    map[string]interface{}{"list": []interface{}{1, "two"}},
+		Fixed:  [2]bool{true, false},
+		Bytes:  []byte("hi"),
+	}
+	config := FlattenerConfig{Prefix: "p-", Separator: ".", OmitEmpty: true, OmitNil: true}
+
+	jsonStr, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := FlatJSONToMap(string(jsonStr), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromStruct := FlatStruct(input, config)
+
+	if len(fromJSON) != len(fromStruct) {
+		t.Errorf("key count mismatch, struct: %v, json: %v", fromStruct, fromJSON)
+	}
+	for key := range fromJSON {
+		if _, ok := fromStruct[key]; !ok {
+			t.Errorf("key %q missing from FlatStruct output: %v", key, fromStruct)
+		}
+	}
+	if fromStruct["p-C.1.D"] != 11 || fromStruct["p-Nested.1.0"] != "z" || fromStruct["p-Any.list.1"] != "two" || fromStruct["p-Bytes"] != "aGk=" {
+		t.Errorf("unexpected values: %v", fromStruct)
+	}
+
+	var back struct{ Bytes []byte }
+	if err := UnflattenInto(map[string]interface{}{"Bytes": "aGk="}, &back); err != nil || string(back.Bytes) != "hi" {
+		t.Errorf("unexpected bytes: %q, %v", back.Bytes, err)
+	}
+}
+
+func TestFlattenTopLevelScalar(t *testing.T) {
+	got := FlatStruct(42)
+	expected := map[string]interface{}{"": 42}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, got)
+	}
+}
+
+func TestFlatStructE(t *testing.T) {
+	badJSON := `{"a": [1, 2}`
+	input := struct {
+		Name     string
+		Callback func()
+		Events   chan int
+		Policy   *string
+	}{
+		Name:     "test",
+		Callback: func() {},
+		Events:   make(chan int),
+		Policy:   &badJSON,
+	}
+
+	got, err := FlatStructE(input)
+	if got != nil {
+		t.Errorf("expected nil map on error, got: %v", got)
+	}
+
+	var unsupported *UnsupportedTypeError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("expected UnsupportedTypeError, got: %v", err)
+	}
+	var nested *NestedJSONError
+	if !errors.As(err, &nested) || nested.Key != "Policy" {
+		t.Errorf("expected NestedJSONError for Policy, got: %v", err)
+	}
+
+	expected := map[string]interface{}{"Name": "test", "Policy": badJSON}
+	if lenient := FlatStruct(input); !reflect.DeepEqual(lenient, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, lenient)
+	}
+
+	for _, scalar := range []interface{}{42, "plain", []int{1, 2}} {
+		if _, err := FlatStructE(scalar); err != nil {
+			t.Errorf("unexpected error for %v: %v", scalar, err)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		line      int
+		column    int
+		truncated bool
+	}{
+		{name: "SyntaxError", input: "{\n  \"a\": 1,\n  \"b\" 2\n}", line: 3, column: 7},
+		{name: "Truncated", input: "{\n  \"a\": [1, 2", line: 2, column: 12, truncated: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FlatJSONToMap(test.input)
+			if !errors.Is(err, ErrInvalidType) {
+				t.Errorf("expected ErrInvalidType, got: %v", err)
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected ParseError, got: %T", err)
+			}
+			if parseErr.Line != test.line || parseErr.Column != test.column {
+				t.Errorf("expected line %d column %d, got: %v", test.line, test.column, parseErr)
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) != test.truncated {
+				t.Errorf("unexpected truncation state for: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	input := `{"UserName": "s3-operator", "Policy": {"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"]}], "Empty": {}}}`
+
+	got, err := FlatJSONToMap(input, FlattenerConfig{Separator: ".", OmitEmpty: true, MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"UserName":         "s3-operator",
+		"Policy.Statement": `[{"Action":["s3:GetObject"],"Effect":"Allow"}]`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, got)
+	}
+
+	streamed := make(map[string]interface{})
+	err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+		streamed[key] = value
+		return nil
+	}, FlattenerConfig{Separator: ".", OmitEmpty: true, MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, streamed)
+	}
+
+	group := Group{Name: "Admins", Members: []*Member{{User: &User{Username: "john_doe"}, Role: "Admin"}}}
+	raw := FlatStruct(group, FlattenerConfig{Separator: ".", OmitEmpty: true, MaxDepth: 3, RawRemainder: true})
+	if !reflect.DeepEqual(raw["Members.0.User"], map[string]interface{}{"Username": "john_doe"}) || raw["Members.0.Role"] != "Admin" {
+		t.Errorf("expected raw remainder at Members.0.User, got: %v", raw)
+	}
+
+	type Limits struct {
+		Quota big.Int `json:"quota"`
+	}
+	type Account struct {
+		Limits Limits            `json:"limits"`
+		Tags   []string          `json:"tags"`
+		Labels map[string]string `json:"labels"`
+	}
+	account := &Account{Limits: Limits{Quota: *big.NewInt(5)}}
+	config := FlattenerConfig{Separator: ".", MaxDepth: 1}
+	fromStruct := FlatStruct(account, config)
+	data, _ := json.Marshal(account)
+	fromJSON, err := FlatJSONToMap(string(data), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{"limits": `{"quota":5}`, "tags": nil, "labels": nil}
+	if !reflect.DeepEqual(fromJSON, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, fromJSON)
+	}
+	if !reflect.DeepEqual(fromStruct, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, fromStruct)
+	}
+}
+
+func TestRemainderStructTags(t *testing.T) {
+	type Credentials struct {
+		User    string `json:"user"`
+		Secret  string `json:"secret" flat:"-"`
+		Renamed string `json:"old" flat:"new"`
+		Token   string `json:"token"`
+	}
+	type Account struct {
+		Creds Credentials   `json:"creds"`
+		Keys  []Credentials `json:"keys"`
+	}
+	creds := Credentials{User: "u", Secret: "hunter2", Renamed: "r", Token: "t"}
+	input := Account{Creds: creds, Keys: []Credentials{creds}}
+	nested := map[string]interface{}{"user": "u", "new": "r"}
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:     "MaxDepth",
+			config:   FlattenerConfig{Separator: ".", MaxDepth: 1, Exclude: []string{"**.token"}},
+			expected: map[string]interface{}{"creds": `{"new":"r","user":"u"}`, "keys": `[{"new":"r","user":"u"}]`},
+		},
+		{
+			name:     "RawRemainder",
+			config:   FlattenerConfig{Separator: ".", MaxDepth: 1, RawRemainder: true, Exclude: []string{"**.token"}},
+			expected: map[string]interface{}{"creds": nested, "keys": []interface{}{nested}},
+		},
+		{
+			name:     "ArrayKeep",
+			config:   FlattenerConfig{Separator: ".", ArrayMode: ArrayKeep, Exclude: []string{"**.token"}},
+			expected: map[string]interface{}{"creds.user": "u", "creds.new": "r", "keys": []interface{}{nested}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FlatStruct(input, test.config)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+		})
+	}
+}
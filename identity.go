@@ -0,0 +1,98 @@
+package goflat
+
+import (
+	"reflect"
+)
+
+// `identityRule` keys the elements of the arrays matching pattern by the
+// value of their field.
+type identityRule struct {
+	pattern pathPattern
+	field   string
+}
+
+// `compileIdentities` compiles the ArrayIdentity patterns in a stable order.
+func compileIdentities(config FlattenerConfig) ([]identityRule, error) {
+	rules := make([]identityRule, 0, len(config.ArrayIdentity))
+	for _, pattern := range sortedMapKeys(config.ArrayIdentity) {
+		compiled, err := compilePattern(pattern, config, true)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, identityRule{pattern: compiled, field: config.ArrayIdentity[pattern]})
+	}
+	return rules, nil
+}
+
+// `identityField` returns the identity field of the array at path, if any.
+func (f *flattener) identityField(path []pathSegment) string {
+	for _, rule := range f.identities {
+		if rule.pattern.match(path) {
+			return rule.field
+		}
+	}
+	return ""
+}
+
+// `elementSegments` returns the segment of each element of the array at path:
+// the value of the identity field when the array matches an ArrayIdentity
+// pattern, the element index when the field is missing, empty, not a scalar,
+// redacted or its value was already used by a previous element.
+func (f *flattener) elementSegments(path []pathSegment, arr reflect.Value) []pathSegment {
+	field := f.identityField(path)
+	segments := make([]pathSegment, arr.Len())
+	seen := make(map[string]bool)
+	for i := range segments {
+		segments[i] = indexSegment(i)
+		if field == "" {
+			continue
+		}
+		value, ok := identityValue(arr.Index(i), field)
+		if !ok || value == "" || seen[value] {
+			continue
+		}
+		segment := identitySegment(field, value, i)
+		if f.redactor.matches(append(path[:len(path):len(path)], segment, nameSegment(field)), value) {
+			// The value would be left in clear in the keys of the element.
+			continue
+		}
+		seen[value] = true
+		segments[i] = segment
+	}
+	return segments
+}
+
+// `identityValue` returns the scalar value of field in a map or struct
+// element; struct fields are looked up by their flattened name.
+func identityValue(elem reflect.Value, field string) (string, bool) {
+	for (elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface) && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+
+	switch elem.Kind() {
+	case reflect.Map:
+		if elem.Type().Key().Kind() != reflect.String {
+			return "", false
+		}
+		value := elem.MapIndex(reflect.ValueOf(field).Convert(elem.Type().Key()))
+		if !value.IsValid() {
+			return "", false
+		}
+		return scalarString(value)
+	case reflect.Struct:
+		for _, info := range typeFields(elem.Type()) {
+			value, ok := fieldByIndex(elem, info.index, false)
+			if !ok {
+				continue
+			}
+			if info.name == "" {
+				if value, found := identityValue(value, field); found {
+					return value, true
+				}
+			} else if info.name == field {
+				return scalarString(value)
+			}
+		}
+	}
+	return "", false
+}
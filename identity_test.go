@@ -0,0 +1,120 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArrayIdentity(t *testing.T) {
+	input := `{"Statement": [{"Sid": "AllowS3", "Effect": "Allow"}, {"Effect": "Deny"}, {"Sid": "AllowS3", "Effect": "Allow"}, {"Sid": "a.b", "Effect": "Deny"}]}`
+	identity := map[string]string{"Statement": "Sid"}
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:   "Dotted",
+			config: FlattenerConfig{Separator: ".", ArrayIdentity: identity},
+			expected: map[string]interface{}{
+				"Statement[Sid=AllowS3].Sid":    "AllowS3",
+				"Statement[Sid=AllowS3].Effect": "Allow",
+				"Statement.1.Effect":            "Deny",
+				"Statement.2.Sid":               "AllowS3",
+				"Statement.2.Effect":            "Allow",
+				`Statement[Sid="a.b"].Sid`:      "a.b",
+				`Statement[Sid="a.b"].Effect`:   "Deny",
+			},
+		},
+		{
+			name:   "Pointer",
+			config: FlattenerConfig{KeyStyle: KeyStylePointer, ArrayIdentity: identity},
+			expected: map[string]interface{}{
+				"/Statement/0/Sid":    "AllowS3",
+				"/Statement/0/Effect": "Allow",
+				"/Statement/1/Effect": "Deny",
+				"/Statement/2/Sid":    "AllowS3",
+				"/Statement/2/Effect": "Allow",
+				"/Statement/3/Sid":    "a.b",
+				"/Statement/3/Effect": "Deny",
+			},
+		},
+		{
+			name:   "JSONPath",
+			config: FlattenerConfig{KeyStyle: KeyStyleJSONPath, ArrayIdentity: identity},
+			expected: map[string]interface{}{
+				"$.Statement[?(@.Sid=='AllowS3')].Sid":    "AllowS3",
+				"$.Statement[?(@.Sid=='AllowS3')].Effect": "Allow",
+				"$.Statement[1].Effect":                   "Deny",
+				"$.Statement[2].Sid":                      "AllowS3",
+				"$.Statement[2].Effect":                   "Allow",
+				"$.Statement[?(@.Sid=='a.b')].Sid":        "a.b",
+				"$.Statement[?(@.Sid=='a.b')].Effect":     "Deny",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FlatJSONToMap(input, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			streamed := make(map[string]interface{})
+			err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+				streamed[key] = value
+				return nil
+			}, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(streamed, test.expected) {
+				t.Errorf("stream mismatch, got: %v, expected: %v", streamed, test.expected)
+			}
+
+			for key, value := range test.expected {
+				if got, err := GetJSON([]byte(input), key, test.config); err != nil || got != value {
+					t.Errorf("%s: got: %v, %v, expected: %v", key, got, err, value)
+				}
+			}
+		})
+	}
+}
+
+func TestArrayIdentityStruct(t *testing.T) {
+	type Container struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+	input := struct {
+		Containers []Container `json:"containers"`
+	}{
+		Containers: []Container{{Name: "app", Image: "app:1.0"}, {Image: "sidecar:2.1"}},
+	}
+
+	config := FlattenerConfig{Separator: ".", ArrayIdentity: map[string]string{"containers": "name"}}
+	got := FlatStruct(input, config)
+	expected := map[string]interface{}{
+		"containers[name=app].name":  "app",
+		"containers[name=app].image": "app:1.0",
+		"containers.1.name":          "",
+		"containers.1.image":         "sidecar:2.1",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestArrayIdentityInvalidPattern(t *testing.T) {
+	config := FlattenerConfig{Separator: ".", ArrayIdentity: map[string]string{"": "Sid"}}
+	if _, err := FlatJSONToMap(`{"a": 1}`, config); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expected ErrInvalidPattern, got: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package goflat
+
+import (
+	"encoding/json"
+	"iter"
+	"reflect"
+)
+
+// `All` returns an iterator over the flattened leaves of a Go value, using
+// the same traversal as FlatStruct without building the result map. Values
+// that cannot be flattened are skipped, nothing is yielded when config is
+// invalid and SortKeys has no effect.
+func All(input interface{}, config ...FlattenerConfig) iter.Seq2[string, interface{}] {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	return func(yield func(string, interface{}) bool) {
+		f := newFlattener(cfg, yieldLeaf(yield))
+		if len(f.errs) > 0 {
+			return
+		}
+		f.flattenFields(reflect.ValueOf(input), nil)
+	}
+}
+
+// `AllJSON` returns an iterator over the flattened leaves of a JSON document,
+// using the same traversal as FlatJSONToMap without building the result map.
+// Nothing is yielded when data is not valid JSON or config is invalid, and
+// SortKeys has no effect.
+func AllJSON(data []byte, config ...FlattenerConfig) iter.Seq2[string, interface{}] {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	return func(yield func(string, interface{}) bool) {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return
+		}
+		f := newFlattener(cfg, yieldLeaf(yield))
+		if len(f.errs) > 0 {
+			return
+		}
+		f.flatten(nil, value)
+	}
+}
+
+// `yieldLeaf` adapts an iterator yield function to the flattener emit.
+func yieldLeaf(yield func(string, interface{}) bool) func(string, []pathSegment, interface{}) bool {
+	return func(key string, _ []pathSegment, value interface{}) bool {
+		return yield(key, value)
+	}
+}
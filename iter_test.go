@@ -0,0 +1,52 @@
+package goflat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	members := Member{
+		User: &User{Username: "john_doe", Email: "john@example.com"}, Role: "Admin", Active: true,
+	}
+	config := FlattenerConfig{Separator: ".", OmitEmpty: true, KeysToLower: true}
+
+	got := make(map[string]interface{})
+	for key, value := range All(members, config) {
+		got[key] = value
+	}
+	if expected := FlatStruct(members, config); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, got)
+	}
+}
+
+func TestAllJSON(t *testing.T) {
+	input := []byte(`[{"a": "3"}, {"a": "3", "C": [{"c": 10}, {"d": 11}]}]`)
+
+	got := make(map[string]interface{})
+	for key, value := range AllJSON(input) {
+		got[key] = value
+	}
+	expected, err := FlatJSONToMap(string(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v\ngot: %v", expected, got)
+	}
+
+	count := 0
+	for range AllJSON(input) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("expected to stop after 2 leaves, got: %d", count)
+	}
+
+	for key := range AllJSON([]byte(`{"a":`)) {
+		t.Errorf("unexpected leaf for invalid JSON: %q", key)
+	}
+}
@@ -0,0 +1,413 @@
+package goflat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid flattened key")
+
+// `KeyStyle` selects the notation used to build flattened keys.
+type KeyStyle int
+
+const (
+	// `KeyStyleDotted` joins every segment with the Separator: `a.b.0.c`.
+	KeyStyleDotted KeyStyle = iota
+	// `KeyStyleBracket` joins object keys with the Separator and writes array
+	// indexes in brackets: `a.b[0].c`; keys containing the Separator are
+	// quoted: `a["x.y"]`.
+	KeyStyleBracket
+	// `KeyStylePointer` builds RFC 6901 JSON Pointers: `/a/b/0/c`.
+	KeyStylePointer
+	// `KeyStyleJSONPath` builds JSONPath expressions: `$.a.b[0].c`.
+	KeyStyleJSONPath
+)
+
+// `pathSegment` is an object key or an array index in a flattened key. Array
+// elements keyed by an identity field keep their index while name holds the
+// identity value; the index is -1 when the segment is read from a key.
+type pathSegment struct {
+	name     string
+	index    int
+	isIndex  bool
+	identity string
+}
+
+// `nameSegment` returns the segment for an object key.
+func nameSegment(name string) pathSegment {
+	return pathSegment{name: name}
+}
+
+// `indexSegment` returns the segment for an array index.
+func indexSegment(index int) pathSegment {
+	return pathSegment{name: strconv.Itoa(index), index: index, isIndex: true}
+}
+
+// `identitySegment` returns the segment for an array element keyed by the
+// value of its identity field.
+func identitySegment(field, value string, index int) pathSegment {
+	return pathSegment{name: value, index: index, isIndex: true, identity: field}
+}
+
+// `formatKey` builds the flattened key of a path, including the Prefix.
+func formatKey(path []pathSegment, config FlattenerConfig) string {
+	var b strings.Builder
+	b.WriteString(config.Prefix)
+	if config.KeyStyle == KeyStyleJSONPath {
+		b.WriteString("$")
+	}
+
+	for i, segment := range path {
+		if segment.identity != "" {
+			b.WriteString(formatIdentity(segment, config))
+			continue
+		}
+		switch config.KeyStyle {
+		case KeyStyleBracket:
+			if segment.isIndex {
+				b.WriteString("[" + segment.name + "]")
+			} else if needsQuoting(segment.name, config.Separator) {
+				b.WriteString("[" + strconv.Quote(segment.name) + "]")
+			} else {
+				if i > 0 {
+					b.WriteString(config.Separator)
+				}
+				b.WriteString(segment.name)
+			}
+		case KeyStylePointer:
+			b.WriteString("/" + pointerEscaper.Replace(segment.name))
+		case KeyStyleJSONPath:
+			if segment.isIndex {
+				b.WriteString("[" + segment.name + "]")
+			} else if isIdentifier(segment.name) {
+				b.WriteString("." + segment.name)
+			} else {
+				b.WriteString("['" + jsonPathEscaper.Replace(segment.name) + "']")
+			}
+		default:
+			if i > 0 {
+				b.WriteString(config.Separator)
+			}
+			b.WriteString(segment.name)
+		}
+	}
+	return b.String()
+}
+
+// `formatIdentity` formats an identity segment: `[Sid=AllowS3]`, or a JSONPath
+// filter `[?(@.Sid=='AllowS3')]`. JSON Pointers keep the element index so
+// they always address the element.
+func formatIdentity(segment pathSegment, config FlattenerConfig) string {
+	switch config.KeyStyle {
+	case KeyStylePointer:
+		return "/" + strconv.Itoa(segment.index)
+	case KeyStyleJSONPath:
+		return "[?(@." + segment.identity + "=='" + jsonPathEscaper.Replace(segment.name) + "')]"
+	}
+	value := segment.name
+	if needsQuoting(value, config.Separator) {
+		value = strconv.Quote(value)
+	}
+	return "[" + segment.identity + "=" + value + "]"
+}
+
+// `parseKey` strips the Prefix from a flattened key and splits it into
+// segments following the configured KeyStyle. Numeric segments of dotted keys
+// and JSON Pointers are read as array indexes.
+func parseKey(key string, config FlattenerConfig) ([]pathSegment, error) {
+	key = strings.TrimPrefix(key, config.Prefix)
+
+	var path []pathSegment
+	var err error
+	switch config.KeyStyle {
+	case KeyStyleBracket:
+		path, err = parseBracketKey(key, config.Separator)
+	case KeyStylePointer:
+		path, err = parsePointerKey(key)
+	case KeyStyleJSONPath:
+		path, err = parseJSONPathKey(key)
+	default:
+		path = parseDottedKey(key, config.Separator)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidKey, key, err)
+	}
+	return path, nil
+}
+
+// `keyPath` returns the segments of a flattened key to match it against
+// patterns; keys that cannot be parsed are a single segment.
+func keyPath(key string, config FlattenerConfig) []pathSegment {
+	path, err := parseKey(key, config)
+	if err != nil {
+		return []pathSegment{nameSegment(key)}
+	}
+	return path
+}
+
+// `numericSegment` returns an index segment for numeric names, a name
+// segment otherwise.
+func numericSegment(name string) pathSegment {
+	if index, ok := parseIndex(name); ok {
+		return indexSegment(index)
+	}
+	return nameSegment(name)
+}
+
+// `parseDottedKey` splits a dotted key on the separator; identity segments
+// such as `Statement[Sid=AllowS3]` are read as an object key followed by the
+// array element holding that identity.
+func parseDottedKey(key, separator string) []pathSegment {
+	if key == "" {
+		return nil
+	}
+
+	var path []pathSegment
+	var name strings.Builder
+	pending := true
+	for i := 0; i < len(key); {
+		if key[i] == '[' {
+			segment, n, ok := parseIdentity(key[i:])
+			rest := key[i+n:]
+			if ok && (rest == "" || rest[0] == '[' || (separator != "" && strings.HasPrefix(rest, separator))) {
+				if name.Len() > 0 {
+					path = append(path, numericSegment(name.String()))
+					name.Reset()
+				}
+				path = append(path, segment)
+				pending = false
+				i += n
+				continue
+			}
+		}
+		if separator != "" && strings.HasPrefix(key[i:], separator) {
+			if pending {
+				path = append(path, numericSegment(name.String()))
+			}
+			name.Reset()
+			pending = true
+			i += len(separator)
+			continue
+		}
+		name.WriteByte(key[i])
+		pending = true
+		i++
+	}
+	if pending {
+		path = append(path, numericSegment(name.String()))
+	}
+	return path
+}
+
+// `parseIdentity` parses an identity segment at the start of s, `[Sid=AllowS3]`
+// or `[Sid="a.b"]`, and returns it with the number of bytes consumed.
+func parseIdentity(s string) (pathSegment, int, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return pathSegment{}, 0, false
+	}
+	eq := strings.IndexAny(s[1:], `=]["`) + 1
+	if eq < 2 || s[eq] != '=' {
+		return pathSegment{}, 0, false
+	}
+	field := s[1:eq]
+	rest := s[eq+1:]
+	if strings.HasPrefix(rest, `"`) {
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				if i+1 >= len(rest) || rest[i+1] != ']' {
+					return pathSegment{}, 0, false
+				}
+				value, err := strconv.Unquote(rest[:i+1])
+				if err != nil {
+					return pathSegment{}, 0, false
+				}
+				return identitySegment(field, value, -1), eq + i + 3, true
+			}
+		}
+		return pathSegment{}, 0, false
+	}
+	end := strings.IndexAny(rest, `[]"`)
+	if end < 0 || rest[end] != ']' {
+		return pathSegment{}, 0, false
+	}
+	return identitySegment(field, rest[:end], -1), eq + end + 2, true
+}
+
+// `parseBracketKey` parses keys such as `a.b[0]["x.y"]`.
+func parseBracketKey(key, separator string) ([]pathSegment, error) {
+	var path []pathSegment
+	for i := 0; i < len(key); {
+		if key[i] == '[' {
+			segment, n, err := parseBracket(key[i:])
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, segment)
+			i += n
+			continue
+		}
+
+		// Object keys after the first segment follow the separator.
+		if len(path) > 0 && separator != "" {
+			if !strings.HasPrefix(key[i:], separator) {
+				return nil, fmt.Errorf("expected %q at offset %d", separator, i)
+			}
+			i += len(separator)
+		}
+		end := i
+		for end < len(key) && key[end] != '[' && (separator == "" || !strings.HasPrefix(key[end:], separator)) {
+			end++
+		}
+		path = append(path, nameSegment(key[i:end]))
+		i = end
+	}
+	return path, nil
+}
+
+// `parsePointerKey` parses RFC 6901 JSON Pointers such as `/a/b/0`.
+func parsePointerKey(key string) ([]pathSegment, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if key[0] != '/' {
+		return nil, errors.New("JSON Pointer must start with '/'")
+	}
+
+	var path []pathSegment
+	for _, name := range strings.Split(key[1:], "/") {
+		path = append(path, numericSegment(pointerUnescaper.Replace(name)))
+	}
+	return path, nil
+}
+
+// `parseJSONPathKey` parses JSONPath expressions such as `$.a['x.y'][0]`.
+func parseJSONPathKey(key string) ([]pathSegment, error) {
+	if !strings.HasPrefix(key, "$") {
+		return nil, errors.New("JSONPath must start with '$'")
+	}
+
+	var path []pathSegment
+	for i := 1; i < len(key); {
+		switch key[i] {
+		case '.':
+			end := strings.IndexAny(key[i+1:], ".[")
+			if end < 0 {
+				end = len(key) - i - 1
+			}
+			path = append(path, nameSegment(key[i+1:i+1+end]))
+			i += 1 + end
+		case '[':
+			segment, n, err := parseBracket(key[i:])
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, segment)
+			i += n
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", key[i], i)
+		}
+	}
+	return path, nil
+}
+
+// `parseBracket` parses a bracketed index, quoted name or identity at the
+// start of s and returns the segment with the number of bytes consumed.
+func parseBracket(s string) (pathSegment, int, error) {
+	if strings.HasPrefix(s, "[?(@.") {
+		return parseJSONPathFilter(s)
+	}
+	if segment, n, ok := parseIdentity(s); ok {
+		return segment, n, nil
+	}
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == s[1] {
+				if i+1 >= len(s) || s[i+1] != ']' {
+					return pathSegment{}, 0, errors.New("missing closing bracket")
+				}
+				name, err := unquote(s[1 : i+1])
+				if err != nil {
+					return pathSegment{}, 0, err
+				}
+				return nameSegment(name), i + 2, nil
+			}
+		}
+		return pathSegment{}, 0, errors.New("missing closing quote")
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return pathSegment{}, 0, errors.New("missing closing bracket")
+	}
+	index, ok := parseIndex(s[1:end])
+	if !ok {
+		return pathSegment{}, 0, fmt.Errorf("invalid array index %q", s[1:end])
+	}
+	return indexSegment(index), end + 1, nil
+}
+
+// `parseJSONPathFilter` parses the JSONPath form of an identity segment,
+// `[?(@.Sid=='AllowS3')]`.
+func parseJSONPathFilter(s string) (pathSegment, int, error) {
+	eq := strings.Index(s, "=='")
+	if eq < 0 {
+		return pathSegment{}, 0, errors.New("invalid filter")
+	}
+	field := s[len("[?(@."):eq]
+	for i := eq + 3; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '\'' {
+			if !strings.HasPrefix(s[i+1:], ")]") {
+				return pathSegment{}, 0, errors.New("missing closing bracket")
+			}
+			return identitySegment(field, jsonPathUnescaper.Replace(s[eq+3:i]), -1), i + 3, nil
+		}
+	}
+	return pathSegment{}, 0, errors.New("missing closing quote")
+}
+
+// `unquote` removes the quotes of a bracketed name.
+func unquote(s string) (string, error) {
+	if s[0] == '"' {
+		return strconv.Unquote(s)
+	}
+	return jsonPathUnescaper.Replace(s[1 : len(s)-1]), nil
+}
+
+// `needsQuoting` reports whether a name must be quoted in bracket keys.
+func needsQuoting(name, separator string) bool {
+	return name == "" || strings.ContainsAny(name, `[]"`) || (separator != "" && strings.Contains(name, separator))
+}
+
+// `isIdentifier` reports whether a name can use the JSONPath dot notation.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && (i == 0 || !('0' <= r && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	pointerEscaper    = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper  = strings.NewReplacer("~1", "/", "~0", "~")
+	jsonPathEscaper   = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	jsonPathUnescaper = strings.NewReplacer(`\\`, `\`, `\'`, `'`)
+)
@@ -0,0 +1,89 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKeyStyles(t *testing.T) {
+	input := `{"a": {"b": [{"c": 1}], "x.y": "dot", "s/l~": "escaped", "0": "zero"}}`
+
+	tests := []struct {
+		name     string
+		config   FlattenerConfig
+		expected map[string]interface{}
+	}{
+		{
+			name:   "Dotted",
+			config: FlattenerConfig{Separator: "."},
+			expected: map[string]interface{}{
+				"a.b.0.c": 1.0, "a.x.y": "dot", "a.s/l~": "escaped", "a.0": "zero",
+			},
+		},
+		{
+			name:   "Bracket",
+			config: FlattenerConfig{Separator: ".", KeyStyle: KeyStyleBracket},
+			expected: map[string]interface{}{
+				"a.b[0].c": 1.0, `a["x.y"]`: "dot", "a.s/l~": "escaped", "a.0": "zero",
+			},
+		},
+		{
+			name:   "Pointer",
+			config: FlattenerConfig{KeyStyle: KeyStylePointer},
+			expected: map[string]interface{}{
+				"/a/b/0/c": 1.0, "/a/x.y": "dot", "/a/s~1l~0": "escaped", "/a/0": "zero",
+			},
+		},
+		{
+			name:   "JSONPath",
+			config: FlattenerConfig{KeyStyle: KeyStyleJSONPath},
+			expected: map[string]interface{}{
+				"$.a.b[0].c": 1.0, "$.a['x.y']": "dot", "$.a['s/l~']": "escaped", "$.a['0']": "zero",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FlatJSONToMap(input, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+
+			for key := range got {
+				path, err := parseKey(key, test.config)
+				if err != nil {
+					t.Fatalf("failed to parse %q: %v", key, err)
+				}
+				if formatted := formatKey(path, test.config); formatted != key {
+					t.Errorf("key %q formatted back as %q", key, formatted)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyStylesUnflatten(t *testing.T) {
+	flat := map[string]interface{}{`a["x.y"]`: "dot", "a.b[1]": "one", "a.c.0": "zero"}
+	got, err := Unflatten(flat, FlattenerConfig{Separator: ".", KeyStyle: KeyStyleBracket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"a": map[string]interface{}{
+		"x.y": "dot",
+		"b":   []interface{}{nil, "one"},
+		"c":   map[string]interface{}{"0": "zero"},
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	_, err = Unflatten(map[string]interface{}{"a[0": 1}, FlattenerConfig{Separator: ".", KeyStyle: KeyStyleBracket})
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got: %v", err)
+	}
+}
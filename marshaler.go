@@ -0,0 +1,213 @@
+package goflat
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// `FlatMarshaler` is implemented by types with their own flattened form.
+// FlattenInto receives the flattened key of the value and calls emit for each
+// of its leaves with a key relative to the value, split on the Separator;
+// values are flattened further unless the key is empty, in which case the
+// value is stored as-is at the key of the value. An error returned by
+// FlattenInto is reported as a MarshalerError.
+type FlatMarshaler interface {
+	FlattenInto(prefix string, emit func(key string, v interface{})) error
+}
+
+// `FlatHook` flattens the values found at the paths matching a Hooks pattern,
+// as FlatMarshaler does for types; it applies to JSON input and Go values.
+type FlatHook func(prefix string, value interface{}, emit func(key string, v interface{})) error
+
+// `hookRule` calls hook on the values found at the paths matching pattern.
+type hookRule struct {
+	pattern pathPattern
+	hook    FlatHook
+}
+
+// `compileHooks` compiles the Hooks patterns in a stable order.
+func compileHooks(config FlattenerConfig) ([]hookRule, error) {
+	rules := make([]hookRule, 0, len(config.Hooks))
+	for _, pattern := range sortedMapKeys(config.Hooks) {
+		compiled, err := compilePattern(pattern, config, true)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, hookRule{pattern: compiled, hook: config.Hooks[pattern]})
+	}
+	return rules, nil
+}
+
+// `hookAt` returns the hook of the first Hooks pattern matching path.
+func (f *flattener) hookAt(path []pathSegment) FlatHook {
+	for _, rule := range f.hooks {
+		if rule.pattern.match(path) {
+			return rule.hook
+		}
+	}
+	return nil
+}
+
+var (
+	flatMarshalerType   = reflect.TypeOf((*FlatMarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	stringerType        = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// `LeafInterface` is a set of interfaces whose values are flattened as leaves
+// holding their own encoding; the zero value stands for
+// DefaultLeafInterfaces.
+type LeafInterface int
+
+const (
+	// `LeafJSONMarshaler` flattens the output of json.Marshaler values, so
+	// they appear as in their JSON encoding.
+	LeafJSONMarshaler LeafInterface = 1 << iota
+	// `LeafTextMarshaler` stores the text of encoding.TextMarshaler values.
+	LeafTextMarshaler
+	// `LeafStringer` stores the string of fmt.Stringer values.
+	LeafStringer
+	// `LeafNone` walks the values whatever interfaces they implement; with
+	// other flags only those are used.
+	LeafNone
+
+	// `DefaultLeafInterfaces` uses the encoding/json ones.
+	DefaultLeafInterfaces = LeafJSONMarshaler | LeafTextMarshaler
+)
+
+// `DurationFormat` selects how time.Duration values are stored.
+type DurationFormat int
+
+const (
+	// `DurationNanoseconds` stores the number of nanoseconds, as encoding/json.
+	DurationNanoseconds DurationFormat = iota
+	// `DurationString` stores the duration as formatted by String: `1h30m0s`.
+	DurationString
+	// `DurationSeconds` stores the number of seconds as a float.
+	DurationSeconds
+)
+
+// `implementer` returns val, or its address when the methods of typ have
+// pointer receivers, as typ.
+func implementer(val reflect.Value, typ reflect.Type) (interface{}, bool) {
+	if !val.IsValid() || !val.CanInterface() || ((val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && val.IsNil()) {
+		return nil, false
+	}
+	if val.Kind() != reflect.Interface && val.Type().Implements(typ) {
+		return val.Interface(), true
+	}
+	if val.Kind() != reflect.Ptr && val.CanAddr() && reflect.PointerTo(val.Type()).Implements(typ) {
+		return val.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// `flatMarshaler` returns the FlatMarshaler implemented by val.
+func flatMarshaler(val reflect.Value) (FlatMarshaler, bool) {
+	m, ok := implementer(val, flatMarshalerType)
+	if !ok {
+		return nil, false
+	}
+	return m.(FlatMarshaler), true
+}
+
+// `marshalLeaf` flattens time.Time and time.Duration values, and values
+// implementing one of the LeafInterfaces, with their own encoding; it returns
+// false when val must be walked instead.
+func (f *flattener) marshalLeaf(path []pathSegment, val reflect.Value) bool {
+	// Pointers are checked once dereferenced, so TimeFormat applies to
+	// *time.Time too; their elements are addressable for pointer receivers.
+	if !val.IsValid() || !val.CanInterface() || val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		return false
+	}
+
+	switch val.Type() {
+	case timeType:
+		t := val.Interface().(time.Time)
+		if !f.omit(val) {
+			layout := f.config.TimeFormat
+			if layout == "" {
+				layout = time.RFC3339Nano
+			}
+			f.leaf(path, t.Format(layout))
+		}
+		return true
+	case durationType:
+		d := val.Interface().(time.Duration)
+		if f.omit(val) {
+			return true
+		}
+		switch f.config.DurationFormat {
+		case DurationString:
+			f.leaf(path, d.String())
+		case DurationSeconds:
+			f.leaf(path, d.Seconds())
+		default:
+			f.leaf(path, int64(d))
+		}
+		return true
+	}
+
+	interfaces := f.config.LeafInterfaces
+	if interfaces == 0 {
+		interfaces = DefaultLeafInterfaces
+	}
+	if m, ok := implementer(val, jsonMarshalerType); ok && interfaces&LeafJSONMarshaler != 0 {
+		data, err := m.(json.Marshaler).MarshalJSON()
+		var value interface{}
+		if err == nil {
+			err = json.Unmarshal(data, &value)
+		}
+		if err != nil {
+			f.errs = append(f.errs, &MarshalerError{Key: formatKey(path, f.config), Type: val.Type(), Err: err})
+			return true
+		}
+		f.flatten(path, value)
+		return true
+	}
+	if m, ok := implementer(val, textMarshalerType); ok && interfaces&LeafTextMarshaler != 0 {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			f.errs = append(f.errs, &MarshalerError{Key: formatKey(path, f.config), Type: val.Type(), Err: err})
+			return true
+		}
+		f.flatten(path, string(text))
+		return true
+	}
+	if m, ok := implementer(val, stringerType); ok && interfaces&LeafStringer != 0 {
+		f.flatten(path, m.(fmt.Stringer).String())
+		return true
+	}
+	return false
+}
+
+// `marshal` calls a FlatMarshaler or FlatHook flattening the value at path,
+// passing the emitted values to walk; typ is nil for hooks.
+func (f *flattener) marshal(path []pathSegment, typ reflect.Type, flattenInto func(prefix string, emit func(key string, v interface{})) error, walk func(path []pathSegment, v interface{})) {
+	prefix := formatKey(path, f.config)
+	err := flattenInto(prefix, func(key string, v interface{}) {
+		if f.stopped {
+			return
+		}
+		if key == "" {
+			f.leaf(path, v)
+			return
+		}
+		relative, err := parseKey(key, FlattenerConfig{Separator: f.config.Separator})
+		if err != nil {
+			f.errs = append(f.errs, &MarshalerError{Key: prefix, Type: typ, Err: err})
+			return
+		}
+		walk(append(path[:len(path):len(path)], relative...), v)
+	})
+	if err != nil {
+		f.errs = append(f.errs, &MarshalerError{Key: prefix, Type: typ, Err: err})
+	}
+}
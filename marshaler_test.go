@@ -0,0 +1,234 @@
+package goflat
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int
+}
+
+func (p point) FlattenInto(prefix string, emit func(key string, v interface{})) error {
+	emit("", fmt.Sprintf("%d,%d", p.X, p.Y))
+	return nil
+}
+
+type resource struct {
+	ARN string
+}
+
+func (r *resource) FlattenInto(prefix string, emit func(key string, v interface{})) error {
+	parts := strings.Split(r.ARN, ":")
+	if len(parts) < 6 {
+		return errors.New("malformed ARN")
+	}
+	emit("service", parts[2])
+	emit("name", parts[5])
+	emit("tags", map[string]interface{}{"source": prefix})
+	return nil
+}
+
+func TestFlatMarshaler(t *testing.T) {
+	input := struct {
+		Origin   point
+		Target   *point
+		Resource *resource
+		Missing  *resource
+	}{
+		Origin:   point{1, 2},
+		Target:   &point{3, 4},
+		Resource: &resource{ARN: "arn:aws:s3:::bucket"},
+	}
+
+	got, err := FlatStructE(input, FlattenerConfig{Separator: ".", OmitEmpty: true, OmitNil: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"Origin":               "1,2",
+		"Target":               "3,4",
+		"Resource.service":     "s3",
+		"Resource.name":        "bucket",
+		"Resource.tags.source": "Resource",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	input.Resource.ARN = "bucket"
+	_, err = FlatStructE(input)
+	var marshalerErr *MarshalerError
+	if !errors.As(err, &marshalerErr) || marshalerErr.Key != "Resource" || marshalerErr.Type != reflect.TypeOf(&resource{}) {
+		t.Errorf("expected MarshalerError at Resource, got: %v", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	input := `{"Statement": [{"Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Effect": "Allow"}]}`
+	config := FlattenerConfig{Separator: ".", Hooks: map[string]FlatHook{
+		"Principal": func(prefix string, value interface{}, emit func(string, interface{})) error {
+			principal, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected principal %v", value)
+			}
+			for kind, id := range principal {
+				emit("", kind+"="+fmt.Sprint(id))
+			}
+			return nil
+		},
+	}}
+	expected := map[string]interface{}{
+		"Statement.0.Principal": "AWS=arn:aws:iam::123456789012:root",
+		"Statement.0.Effect":    "Allow",
+	}
+
+	got, err := FlatJSONToMap(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	streamed := make(map[string]interface{})
+	err = FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+		streamed[key] = value
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("stream mismatch, got: %v, expected: %v", streamed, expected)
+	}
+
+	_, err = FlatJSONToMap(`{"Principal": "*"}`, config)
+	var marshalerErr *MarshalerError
+	if !errors.As(err, &marshalerErr) || marshalerErr.Type != nil {
+		t.Errorf("expected hook MarshalerError, got: %v", err)
+	}
+}
+
+type level int
+
+func (l level) String() string {
+	return [...]string{"low", "high"}[l]
+}
+
+type version struct {
+	Major, Minor int
+}
+
+func (v version) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"major": %d, "minor": %d, "text": "v%d.%d"}`, v.Major, v.Minor, v.Major, v.Minor)), nil
+}
+
+func TestLeafInterfaces(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	input := struct {
+		Created  *time.Time
+		Updated  time.Time
+		Timeout  time.Duration
+		Address  net.IP
+		Level    level
+		Version  version
+		Disabled *time.Time
+	}{
+		Created: &created,
+		Updated: created.Add(time.Hour),
+		Timeout: 90 * time.Second,
+		Address: net.IPv4(10, 0, 0, 1),
+		Level:   1,
+		Version: version{1, 2},
+	}
+
+	got := FlatStruct(input)
+	expected := map[string]interface{}{
+		"Created":       "2024-03-01T12:30:00Z",
+		"Updated":       "2024-03-01T13:30:00Z",
+		"Timeout":       int64(90 * time.Second),
+		"Address":       "10.0.0.1",
+		"Level":         level(1),
+		"Version.major": 1.0,
+		"Version.minor": 2.0,
+		"Version.text":  "v1.2",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	config := defaultConfiguration()
+	config.LeafInterfaces = LeafStringer
+	config.TimeFormat = time.DateOnly
+	config.DurationFormat = DurationString
+	got = FlatStruct(input, config)
+	for key, value := range map[string]interface{}{"Created": "2024-03-01", "Timeout": "1m30s", "Level": "high", "Address": "10.0.0.1", "Version.Major": 1} {
+		if got[key] != value {
+			t.Errorf("%s mismatch, got: %v, expected: %v", key, got[key], value)
+		}
+	}
+
+	config.DurationFormat = DurationSeconds
+	if got := FlatStruct(input, config); got["Timeout"] != 90.0 {
+		t.Errorf("Timeout mismatch, got: %v, expected: 90", got["Timeout"])
+	}
+}
+
+func TestLeafInterfacesZeroValue(t *testing.T) {
+	input := struct {
+		IP net.IP
+		N  *big.Int
+	}{IP: net.IPv4(10, 0, 0, 1).To4(), N: big.NewInt(5)}
+
+	// Config literals get the marshaler leaves too.
+	got := FlatStruct(input, FlattenerConfig{Separator: "."})
+	expected := map[string]interface{}{"IP": "10.0.0.1", "N": 5.0}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+
+	got = FlatStruct(input, FlattenerConfig{Separator: ".", LeafInterfaces: LeafNone})
+	if got["IP"] != "CgAAAQ==" {
+		t.Errorf("expected the IP bytes, got: %v", got)
+	}
+
+	got = FlatStruct(input, FlattenerConfig{Separator: ".", LeafInterfaces: LeafNone | LeafStringer})
+	if got["IP"] != "10.0.0.1" || got["N"] != "5" {
+		t.Errorf("expected Stringer leaves only, got: %v", got)
+	}
+}
+
+func TestLeafInterfacesUnflattenInto(t *testing.T) {
+	type Target struct {
+		Created *time.Time
+		Day     time.Time
+		Timeout time.Duration
+		Delay   time.Duration
+		Address net.IP
+	}
+	flat := map[string]interface{}{
+		"Created": "2024-03-01T12:30:00Z",
+		"Day":     "2024-03-02",
+		"Timeout": "1m30s",
+		"Delay":   1.5,
+		"Address": "10.0.0.1",
+	}
+
+	var target Target
+	config := FlattenerConfig{Separator: ".", TimeFormat: time.DateOnly, DurationFormat: DurationSeconds}
+	flat["Created"] = "2024-03-01"
+	if err := UnflattenInto(flat, &target, config); err != nil {
+		t.Fatal(err)
+	}
+	if !target.Created.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || target.Day.Day() != 2 ||
+		target.Timeout != 90*time.Second || target.Delay != 1500*time.Millisecond || !target.Address.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("unexpected target: %+v", target)
+	}
+}
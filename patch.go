@@ -0,0 +1,414 @@
+package goflat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid JSON Patch operation")
+	ErrTestFailed   = errors.New("JSON Patch test failed")
+)
+
+// `PatchOperation` is an RFC 6902 JSON Patch operation; Path and From are
+// JSON Pointers.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// `MarshalJSON` always writes the value of the add, replace and test
+// operations, even when it is null.
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	type operation PatchOperation
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			operation
+			Value interface{} `json:"value"`
+		}{operation(o), o.Value})
+	}
+	return json.Marshal(operation(o))
+}
+
+// `Patch` is an RFC 6902 JSON Patch document.
+type Patch []PatchOperation
+
+// `KeyToPointer` converts a flattened key into a JSON Pointer; numeric
+// segments of dotted keys are written as array indexes. Identity segments
+// need the document to find their index and are rejected.
+func KeyToPointer(key string, config ...FlattenerConfig) (string, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	path, err := parseKey(key, cfg)
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range path {
+		if segment.identity != "" {
+			return "", fmt.Errorf("%w %q: identity segment %s has no array index", ErrInvalidKey, key, formatIdentity(segment, cfg))
+		}
+	}
+	return formatKey(path, FlattenerConfig{KeyStyle: KeyStylePointer}), nil
+}
+
+// `DiffPatch` returns the JSON Patch transforming the JSON document a into b.
+// Objects are compared member by member and arrays element by element, so
+// inserted and deleted elements become add and remove operations; elements of
+// the arrays matching ArrayIdentity are paired by their identity field.
+// IgnorePaths and Tolerance apply as in DiffJSON.
+func DiffPatch(a, b string, config ...DiffConfig) (Patch, error) {
+	cfg := defaultDiffConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	var docA, docB interface{}
+	if err := json.Unmarshal([]byte(a), &docA); err != nil {
+		return nil, newParseError([]byte(a), err)
+	}
+	if err := json.Unmarshal([]byte(b), &docB); err != nil {
+		return nil, newParseError([]byte(b), err)
+	}
+
+	p := &patcher{config: cfg}
+	ignored, err := compilePatterns(cfg.IgnorePaths, cfg.FlattenerConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	p.ignored = ignored
+	p.identities, err = compileIdentities(cfg.FlattenerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	p.diff(nil, docA, docB)
+	return p.patch, nil
+}
+
+// `patcher` builds the JSON Patch between two decoded JSON documents.
+type patcher struct {
+	config     DiffConfig
+	ignored    []pathPattern
+	identities []identityRule
+	patch      Patch
+}
+
+// `add` appends an operation at path.
+func (p *patcher) add(op string, path []pathSegment, value interface{}) {
+	p.patch = append(p.patch, PatchOperation{Op: op, Path: formatKey(path, FlattenerConfig{KeyStyle: KeyStylePointer}), Value: value})
+}
+
+// `isIgnored` reports whether path matches one of the IgnorePaths.
+func (p *patcher) isIgnored(path []pathSegment) bool {
+	for _, pattern := range p.ignored {
+		if pattern.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// `diff` appends the operations transforming a into b at path.
+func (p *patcher) diff(path []pathSegment, a, b interface{}) {
+	if p.isIgnored(path) {
+		return
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		if y, ok := b.(map[string]interface{}); ok {
+			keys := make(map[string]bool, len(x)+len(y))
+			for key := range x {
+				keys[key] = true
+			}
+			for key := range y {
+				keys[key] = true
+			}
+			for _, key := range sortedMapKeys(keys) {
+				memberPath := append(path[:len(path):len(path)], nameSegment(key))
+				oldValue, inA := x[key]
+				newValue, inB := y[key]
+				switch {
+				case p.isIgnored(memberPath):
+				case !inA:
+					p.add("add", memberPath, newValue)
+				case !inB:
+					p.add("remove", memberPath, nil)
+				default:
+					p.diff(memberPath, oldValue, newValue)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			p.diffArray(path, x, y)
+			return
+		}
+	}
+
+	if valueType(a) == valueType(b) && equalValues(a, b, p.config.Tolerance) {
+		return
+	}
+	p.add("replace", path, b)
+}
+
+// `diffArray` appends the operations transforming the array a into b at path
+// following their longest common subsequence: elements only found in a are
+// removed, elements only found in b are added and the others are compared.
+func (p *patcher) diffArray(path []pathSegment, a, b []interface{}) {
+	field := ""
+	for _, rule := range p.identities {
+		if rule.pattern.match(path) {
+			field = rule.field
+			break
+		}
+	}
+	// Elements with an identity are the same when their identities are.
+	identity := func(x interface{}) (string, bool) {
+		if field == "" {
+			return "", false
+		}
+		id, ok := identityValue(reflect.ValueOf(x), field)
+		return id, ok && id != ""
+	}
+	same := func(x, y interface{}) bool {
+		idX, okX := identity(x)
+		idY, okY := identity(y)
+		if okX && okY {
+			return idX == idY
+		}
+		return reflect.DeepEqual(x, y)
+	}
+	distinct := func(x, y interface{}) bool {
+		_, okX := identity(x)
+		_, okY := identity(y)
+		return okX && okY && !same(x, y)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if same(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// index is the position of the element in the array being patched.
+	index := 0
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		elemPath := append(path[:len(path):len(path)], indexSegment(index))
+		switch {
+		case i < len(a) && j < len(b) && (same(a[i], b[j]) || (lcs[i+1][j+1] == lcs[i][j] && !distinct(a[i], b[j]))):
+			// Matching elements, or elements at the same position of the
+			// subsequence with no different identities, are compared.
+			p.diff(elemPath, a[i], b[j])
+			i, j, index = i+1, j+1, index+1
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			p.add("add", elemPath, b[j])
+			j, index = j+1, index+1
+		default:
+			p.add("remove", elemPath, nil)
+			i++
+		}
+	}
+}
+
+// `ApplyPatch` applies a JSON Patch to a copy of doc, which can be any value
+// encoding/json can marshal, and returns the patched document. Operations are
+// applied in order and the first failing one aborts the patch.
+func ApplyPatch(doc interface{}, patch Patch) (interface{}, error) {
+	result, err := toJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range patch {
+		result, err = applyOperation(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %q): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return result, nil
+}
+
+// `ApplyPatchJSON` applies a JSON Patch to a JSON string.
+func ApplyPatchJSON(jsonStr string, patch Patch) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &doc); err != nil {
+		return "", newParseError([]byte(jsonStr), err)
+	}
+	result, err := ApplyPatch(doc, patch)
+	if err != nil {
+		return "", err
+	}
+	patched, err := json.Marshal(result)
+	if err != nil {
+		return "", newParseError(nil, err)
+	}
+	return string(patched), nil
+}
+
+// `applyOperation` applies a single operation to doc.
+func applyOperation(doc interface{}, op PatchOperation) (interface{}, error) {
+	path, err := parsePointerKey(op.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := toJSONValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "test" {
+			current, err := pointerValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+		return updatePointer(doc, path, op.Op, value)
+	case "remove":
+		return updatePointer(doc, path, "remove", nil)
+	case "move", "copy":
+		from, err := parsePointerKey(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		value, err := pointerValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value, err = toJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if op.Path == op.From {
+				return doc, nil
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move %q into itself", ErrInvalidPatch, op.From)
+			}
+			if doc, err = updatePointer(doc, from, "remove", nil); err != nil {
+				return nil, err
+			}
+		}
+		return updatePointer(doc, path, "add", value)
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+}
+
+// `pointerValue` returns the value found at path.
+func pointerValue(doc interface{}, path []pathSegment) (interface{}, error) {
+	value, err := getPath(doc, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return value, nil
+}
+
+// `updatePointer` adds, replaces or removes the value at path and returns the
+// updated document, since arrays are reallocated when they change length.
+func updatePointer(doc interface{}, path []pathSegment, op string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		if op == "remove" {
+			return nil, nil
+		}
+		return value, nil
+	}
+
+	segment := path[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		current, ok := v[segment.name]
+		if len(path) > 1 {
+			if !ok {
+				return nil, fmt.Errorf("%w: missing member %q", ErrInvalidPatch, segment.name)
+			}
+			child, err := updatePointer(current, path[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			v[segment.name] = child
+			return v, nil
+		}
+		if !ok && op != "add" {
+			return nil, fmt.Errorf("%w: missing member %q", ErrInvalidPatch, segment.name)
+		}
+		if op == "remove" {
+			delete(v, segment.name)
+		} else {
+			v[segment.name] = value
+		}
+		return v, nil
+	case []interface{}:
+		index, ok := parseIndex(segment.name)
+		if segment.name == "-" && op == "add" && len(path) == 1 {
+			index, ok = len(v), true
+		}
+		limit := len(v)
+		if op == "add" && len(path) == 1 {
+			// Elements can be inserted after the last one.
+			limit++
+		}
+		if !ok || index >= limit {
+			return nil, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, segment.name)
+		}
+		if len(path) > 1 {
+			child, err := updatePointer(v[index], path[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			v[index] = child
+			return v, nil
+		}
+		switch op {
+		case "add":
+			v = append(v, nil)
+			copy(v[index+1:], v[index:])
+			v[index] = value
+		case "remove":
+			v = append(v[:index], v[index+1:]...)
+		default:
+			v[index] = value
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: cannot traverse %s at %q", ErrInvalidPatch, valueType(doc), segment.name)
+}
+
+// `toJSONValue` returns a copy of value made of the types produced by
+// encoding/json, so patched documents only hold JSON values.
+func toJSONValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, newParseError(nil, err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, newParseError(data, err)
+	}
+	return result, nil
+}
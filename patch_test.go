@@ -0,0 +1,172 @@
+package goflat
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		config   DiffConfig
+		expected Patch
+	}{
+		{
+			name: "Objects",
+			a:    `{"a": 1, "b": {"c": "x", "d": true}, "e": null}`,
+			b:    `{"a": 1.0001, "b": {"c": "y"}, "e": null, "f": [1]}`,
+			expected: Patch{
+				{Op: "replace", Path: "/a", Value: 1.0001},
+				{Op: "replace", Path: "/b/c", Value: "y"},
+				{Op: "remove", Path: "/b/d"},
+				{Op: "add", Path: "/f", Value: []interface{}{1.0}},
+			},
+		},
+		{
+			name:   "ToleranceAndIgnorePaths",
+			a:      `{"a": 1, "meta": {"rev": 1}}`,
+			b:      `{"a": 1.0001, "meta": {"rev": 2}}`,
+			config: DiffConfig{FlattenerConfig: FlattenerConfig{Separator: "."}, IgnorePaths: []string{"meta"}, Tolerance: 0.001},
+		},
+		{
+			name: "ArrayInsertAndRemove",
+			a:    `{"Action": ["s3:GetObject", "s3:PutObject", "s3:DeleteObject"]}`,
+			b:    `{"Action": ["s3:ListBucket", "s3:GetObject", "s3:DeleteObject"]}`,
+			expected: Patch{
+				{Op: "add", Path: "/Action/0", Value: "s3:ListBucket"},
+				{Op: "remove", Path: "/Action/2"},
+			},
+		},
+		{
+			name: "ArrayElementChanged",
+			a:    `[{"Effect": "Allow", "Action": "s3:*"}]`,
+			b:    `[{"Effect": "Deny", "Action": "s3:*"}]`,
+			expected: Patch{
+				{Op: "replace", Path: "/0/Effect", Value: "Deny"},
+			},
+		},
+		{
+			name:   "ArrayIdentity",
+			a:      `{"Statement": [{"Sid": "A", "Effect": "Allow"}, {"Sid": "B", "Effect": "Allow"}]}`,
+			b:      `{"Statement": [{"Sid": "C", "Effect": "Deny"}, {"Sid": "A", "Effect": "Allow"}, {"Sid": "B", "Effect": "Deny"}]}`,
+			config: DiffConfig{FlattenerConfig: FlattenerConfig{Separator: ".", ArrayIdentity: map[string]string{"Statement": "Sid"}}},
+			expected: Patch{
+				{Op: "add", Path: "/Statement/0", Value: map[string]interface{}{"Sid": "C", "Effect": "Deny"}},
+				{Op: "replace", Path: "/Statement/2/Effect", Value: "Deny"},
+			},
+		},
+		{
+			name:     "Root",
+			a:        `[1]`,
+			b:        `{"a": 1}`,
+			expected: Patch{{Op: "replace", Path: "", Value: map[string]interface{}{"a": 1.0}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			if config.Separator == "" {
+				config = defaultDiffConfiguration()
+			}
+			patch, err := DiffPatch(test.a, test.b, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(patch, test.expected) {
+				t.Errorf("mismatch, got: %+v, expected: %+v", patch, test.expected)
+			}
+			if config.IgnorePaths != nil {
+				return
+			}
+
+			patched, err := ApplyPatchJSON(test.a, patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, expected interface{}
+			_ = json.Unmarshal([]byte(patched), &got)
+			_ = json.Unmarshal([]byte(test.b), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("patched mismatch, got: %s, expected: %s", patched, test.b)
+			}
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	doc := map[string]interface{}{"a": []interface{}{1, 2}, "b": map[string]interface{}{"c": "x"}}
+	patch := Patch{
+		{Op: "test", Path: "/b/c", Value: "x"},
+		{Op: "add", Path: "/a/-", Value: 3},
+		{Op: "copy", From: "/b", Path: "/d"},
+		{Op: "move", From: "/b/c", Path: "/a/0"},
+		{Op: "add", Path: "/e~1f", Value: nil},
+	}
+
+	got, err := ApplyPatch(doc, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a":   []interface{}{"x", 1.0, 2.0, 3.0},
+		"b":   map[string]interface{}{},
+		"d":   map[string]interface{}{"c": "x"},
+		"e/f": nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+	if len(doc["a"].([]interface{})) != 2 {
+		t.Errorf("input document was modified: %v", doc)
+	}
+
+	failures := []struct {
+		op       PatchOperation
+		expected error
+	}{
+		{PatchOperation{Op: "test", Path: "/a/0", Value: 2}, ErrTestFailed},
+		{PatchOperation{Op: "remove", Path: "/a/5"}, ErrInvalidPatch},
+		{PatchOperation{Op: "replace", Path: "/x"}, ErrInvalidPatch},
+		{PatchOperation{Op: "move", From: "/b", Path: "/b/c"}, ErrInvalidPatch},
+		{PatchOperation{Op: "frobnicate", Path: "/a"}, ErrInvalidPatch},
+		{PatchOperation{Op: "add", Path: "a"}, ErrInvalidPatch},
+	}
+	for _, failure := range failures {
+		if _, err := ApplyPatch(doc, Patch{failure.op}); !errors.Is(err, failure.expected) {
+			t.Errorf("%+v: expected %v, got: %v", failure.op, failure.expected, err)
+		}
+	}
+}
+
+func TestPatchOperationMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Patch{{Op: "add", Path: "/a", Value: nil}, {Op: "remove", Path: "/b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"op":"add","path":"/a","value":null},{"op":"remove","path":"/b"}]`
+	if string(data) != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", data, expected)
+	}
+}
+
+func TestKeyToPointer(t *testing.T) {
+	got, err := KeyToPointer("Statement.0.a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/Statement/0/a~1b"; got != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", got, expected)
+	}
+
+	got, err = KeyToPointer(`x-a["b.c"][1]`, FlattenerConfig{Prefix: "x-", Separator: ".", KeyStyle: KeyStyleBracket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/a/b.c/1"; got != expected {
+		t.Errorf("mismatch, got: %s, expected: %s", got, expected)
+	}
+}
@@ -0,0 +1,267 @@
+package goflat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidPattern = errors.New("invalid path pattern")
+
+// `pathPattern` matches paths against a glob pattern written with the
+// configured Separator: `*` matches one segment, `**` any number of segments,
+// `[0:2]` after a segment the array indexes from 0 to 1, `[Sid=Allow*]` the
+// elements keyed by ArrayIdentity whose identity matches and other segments are
+// matched as globs where `*` matches any run of characters and `?` a single
+// one, e.g. `*password*`. Patterns match whole paths; `**.name` matches
+// name at any depth.
+type pathPattern struct {
+	segments  []patternSegment
+	separator string
+}
+
+// `patternSegment` is a glob, `**`, or an index range when ranged is set;
+// a negative high means the range is open. With identity set the glob
+// matches the identity value of the elements keyed by that field.
+type patternSegment struct {
+	glob     string
+	ranged   bool
+	low      int
+	high     int
+	identity string
+	implicit bool
+}
+
+// `compilePattern` splits a pattern into segments and validates them; with
+// anyDepth a pattern made of a single segment matches it at any depth, as
+// ArrayIdentity and RedactKeys patterns do.
+func compilePattern(pattern string, config FlattenerConfig, anyDepth bool) (pathPattern, error) {
+	separator := config.Separator
+	if separator == "" {
+		separator = "."
+	}
+
+	if pattern == "" {
+		return pathPattern{}, fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
+	}
+	parts := splitPattern(pattern, separator)
+	compiled := pathPattern{separator: separator}
+	if anyDepth && len(parts) == 1 && parts[0] != "**" {
+		compiled.segments = append(compiled.segments, patternSegment{glob: "**", implicit: true})
+	}
+	for _, part := range parts {
+		glob, rng, ok := strings.Cut(part, "[")
+		if identity, n, isIdentity := parseIdentity("[" + rng); ok && isIdentity && n == len(rng)+1 {
+			if glob != "" {
+				compiled.segments = append(compiled.segments, patternSegment{glob: glob})
+			}
+			compiled.segments = append(compiled.segments, patternSegment{glob: identity.name, identity: identity.identity})
+			continue
+		}
+		if !ok || !strings.HasSuffix(rng, "]") || strings.Trim(rng, "0123456789:]") != "" {
+			// Brackets holding neither a range nor an identity are matched
+			// literally.
+			compiled.segments = append(compiled.segments, patternSegment{glob: part})
+			continue
+		}
+		segment, err := parseRange(strings.TrimSuffix(rng, "]"))
+		if err != nil {
+			return pathPattern{}, fmt.Errorf("%w %q: %v", ErrInvalidPattern, pattern, err)
+		}
+		if glob != "" {
+			compiled.segments = append(compiled.segments, patternSegment{glob: glob})
+		}
+		compiled.segments = append(compiled.segments, segment)
+	}
+	return compiled, nil
+}
+
+// `splitPattern` splits a pattern on the separator, except inside identity
+// brackets such as `[Sid="a.b"]`.
+func splitPattern(pattern, separator string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(pattern); {
+		if pattern[i] == '[' {
+			if _, n, ok := parseIdentity(pattern[i:]); ok {
+				i += n
+				continue
+			}
+		}
+		if strings.HasPrefix(pattern[i:], separator) {
+			parts = append(parts, pattern[start:i])
+			i += len(separator)
+			start = i
+			continue
+		}
+		i++
+	}
+	return append(parts, pattern[start:])
+}
+
+// `parseRange` parses the inside of an index range: `2`, `0:2`, `1:` or `:3`.
+func parseRange(s string) (patternSegment, error) {
+	low, high, isRange := strings.Cut(s, ":")
+	segment := patternSegment{ranged: true, high: -1}
+	if low != "" {
+		index, err := strconv.Atoi(low)
+		if err != nil || index < 0 {
+			return patternSegment{}, fmt.Errorf("invalid index %q", low)
+		}
+		segment.low = index
+	}
+	switch {
+	case !isRange:
+		if low == "" {
+			return patternSegment{}, errors.New("empty index")
+		}
+		segment.high = segment.low + 1
+	case high != "":
+		index, err := strconv.Atoi(high)
+		if err != nil || index < segment.low {
+			return patternSegment{}, fmt.Errorf("invalid index %q", high)
+		}
+		segment.high = index
+	}
+	return segment, nil
+}
+
+// `compilePatterns` compiles a list of patterns.
+func compilePatterns(patterns []string, config FlattenerConfig, anyDepth bool) ([]pathPattern, error) {
+	compiled := make([]pathPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := compilePattern(pattern, config, anyDepth)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// `match` reports whether the whole path matches the pattern.
+func (p pathPattern) match(path []pathSegment) bool {
+	_, ok := p.capture(path, nil)
+	return ok
+}
+
+// `capture` matches the whole path and appends to captures the segments
+// matched by each wildcard or range; `**` captures its segments joined with
+// the separator.
+func (p pathPattern) capture(path []pathSegment, captures []string) ([]string, bool) {
+	return p.matchSegments(p.segments, path, captures)
+}
+
+// `matchSegments` matches pattern segments against path segments.
+func (p pathPattern) matchSegments(pattern []patternSegment, segments []pathSegment, captures []string) ([]string, bool) {
+	for len(pattern) > 0 {
+		if pattern[0].glob == "**" {
+			for i := 0; i <= len(segments); i++ {
+				next := captures
+				if !pattern[0].implicit {
+					names := make([]string, i)
+					for j, segment := range segments[:i] {
+						names[j] = segment.name
+					}
+					next = append(captures[:len(captures):len(captures)], strings.Join(names, p.separator))
+				}
+				if result, ok := p.matchSegments(pattern[1:], segments[i:], next); ok {
+					return result, true
+				}
+			}
+			return captures, false
+		}
+		if len(segments) == 0 || !pattern[0].matchSegment(segments[0]) {
+			return captures, false
+		}
+		if pattern[0].ranged || strings.ContainsAny(pattern[0].glob, "*?") {
+			captures = append(captures[:len(captures):len(captures)], segments[0].name)
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return captures, len(segments) == 0
+}
+
+// `matchesAncestor` reports whether the pattern matches the path or one of its
+// ancestors.
+func (p pathPattern) matchesAncestor(path []pathSegment) bool {
+	for i := 0; i <= len(path); i++ {
+		if p.match(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// `overlaps` reports whether the pattern matches the path, one of its
+// ancestors or one of its descendants, that is whether the subtree at path
+// may hold matching leaves.
+func (p pathPattern) overlaps(path []pathSegment) bool {
+	return overlapSegments(p.segments, path)
+}
+
+// `overlapSegments` matches pattern segments against path segments until
+// either runs out.
+func overlapSegments(pattern []patternSegment, segments []pathSegment) bool {
+	for len(pattern) > 0 && len(segments) > 0 {
+		if pattern[0].glob == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if overlapSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if !pattern[0].matchSegment(segments[0]) {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return true
+}
+
+// `matchSegment` matches a single pattern segment against a path segment.
+func (p patternSegment) matchSegment(segment pathSegment) bool {
+	if p.ranged {
+		index, ok := arrayIndex(segment)
+		return ok && index >= p.low && (p.high < 0 || index < p.high)
+	}
+	if p.identity != "" {
+		return segment.identity == p.identity && globMatch(p.glob, segment.name)
+	}
+	return globMatch(p.glob, segment.name)
+}
+
+// `globMatch` matches a name against a glob where `*` matches any run of
+// characters, `?` a single character and `\` escapes the next one.
+func globMatch(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if globMatch(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[size:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if name == "" || name[0] != pattern[0] {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
@@ -0,0 +1,100 @@
+package goflat
+
+import (
+	"strings"
+)
+
+// `Match` is a flattened key matched by a query with its value and the
+// segments captured by the wildcards and ranges of the pattern, in order.
+type Match struct {
+	Key      string
+	Value    interface{}
+	Captures []string
+}
+
+// `Query` returns the entries of a flattened map, as built by FlatJSONToMap or
+// FlatStruct with the same config, whose keys match pattern, sorted by key.
+// Patterns are written with the Separator: `*` matches one key segment, `**`
+// any number of segments, `Statement[0:2]` the first two elements of
+// Statement and other segments are globs such as `*Bucket*`; keys are read
+// with the configured Prefix and KeyStyle. Elements keyed by ArrayIdentity
+// are matched by `*` and by ranges at the index Unflatten gives them.
+func Query(flat map[string]interface{}, pattern string, config ...FlattenerConfig) ([]Match, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	compiled, err := compilePattern(pattern, cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := sortedMapKeys(flat)
+	paths := make([][]pathSegment, len(keys))
+	for i, key := range keys {
+		paths[i] = keyPath(key, cfg)
+	}
+	resolveIdentities(paths)
+
+	var matches []Match
+	for i, key := range keys {
+		if captures, ok := compiled.capture(paths[i], nil); ok {
+			matches = append(matches, Match{Key: key, Value: flat[key], Captures: captures})
+		}
+	}
+	return matches, nil
+}
+
+// `resolveIdentities` gives the identity segments of the paths the index
+// Unflatten rebuilds their element at, the first free index in key order,
+// since flattened keys do not record it; paths must be sorted by key.
+func resolveIdentities(paths [][]pathSegment) {
+	used := make(map[string]map[int]bool)
+	for _, path := range paths {
+		for i, segment := range path {
+			if index, ok := parseIndex(segment.name); ok && segment.identity == "" {
+				parent := parentKey(path[:i])
+				if used[parent] == nil {
+					used[parent] = make(map[int]bool)
+				}
+				used[parent][index] = true
+			}
+		}
+	}
+
+	resolved := make(map[string]int)
+	for _, path := range paths {
+		for i, segment := range path {
+			if segment.identity == "" {
+				continue
+			}
+			parent := parentKey(path[:i])
+			child := parent + "\x00" + identityChild(segment)
+			index, ok := resolved[child]
+			if !ok {
+				if used[parent] == nil {
+					used[parent] = make(map[int]bool)
+				}
+				for used[parent][index] {
+					index++
+				}
+				used[parent][index] = true
+				resolved[child] = index
+			}
+			path[i].index = index
+		}
+	}
+}
+
+// `parentKey` identifies the node at path while resolving identities.
+func parentKey(path []pathSegment) string {
+	names := make([]string, len(path))
+	for i, segment := range path {
+		names[i] = segment.name
+		if segment.identity != "" {
+			names[i] = identityChild(segment)
+		}
+	}
+	return strings.Join(names, "\x00")
+}
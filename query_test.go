@@ -0,0 +1,125 @@
+package goflat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	input := `{"Statement": [
+		{"Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"]},
+		{"Effect": "Deny", "Action": ["s3:DeleteBucket"]},
+		{"Effect": "Allow", "Action": ["ec2:StartInstances"], "Condition": {"Bool": {"aws:SecureTransport": "true"}}}
+	]}`
+	flat, err := FlatJSONToMap(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []Match
+	}{
+		{
+			pattern: "Statement.*.Action.*",
+			expected: []Match{
+				{Key: "Statement.0.Action.0", Value: "s3:GetObject", Captures: []string{"0", "0"}},
+				{Key: "Statement.0.Action.1", Value: "s3:PutObject", Captures: []string{"0", "1"}},
+				{Key: "Statement.1.Action.0", Value: "s3:DeleteBucket", Captures: []string{"1", "0"}},
+				{Key: "Statement.2.Action.0", Value: "ec2:StartInstances", Captures: []string{"2", "0"}},
+			},
+		},
+		{
+			pattern: "Statement[0:2].Effect",
+			expected: []Match{
+				{Key: "Statement.0.Effect", Value: "Allow", Captures: []string{"0"}},
+				{Key: "Statement.1.Effect", Value: "Deny", Captures: []string{"1"}},
+			},
+		},
+		{
+			pattern: "Statement[2].**.aws:*",
+			expected: []Match{
+				{Key: "Statement.2.Condition.Bool.aws:SecureTransport", Value: "true", Captures: []string{"2", "Condition.Bool", "aws:SecureTransport"}},
+			},
+		},
+		{
+			pattern: "**.Effect",
+			expected: []Match{
+				{Key: "Statement.0.Effect", Value: "Allow", Captures: []string{"Statement.0"}},
+				{Key: "Statement.1.Effect", Value: "Deny", Captures: []string{"Statement.1"}},
+				{Key: "Statement.2.Effect", Value: "Allow", Captures: []string{"Statement.2"}},
+			},
+		},
+		{
+			pattern:  "Effect",
+			expected: nil,
+		},
+		{
+			pattern:  "Statement[3:].Effect",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := Query(flat, test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %+v, expected: %+v", got, test.expected)
+			}
+		})
+	}
+
+	if _, err := Query(flat, "Statement[2:1]"); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expected ErrInvalidPattern, got: %v", err)
+	}
+}
+
+func TestQueryIdentity(t *testing.T) {
+	config := FlattenerConfig{Separator: ".", ArrayIdentity: map[string]string{"Statement": "Sid"}}
+	flat, err := FlatJSONToMap(`{"Statement": [{"Sid": "AllowS3", "Effect": "Allow"}, {"Effect": "Deny"}]}`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []Match
+	}{
+		{
+			pattern: "Statement.*.Effect",
+			expected: []Match{
+				{Key: "Statement.1.Effect", Value: "Deny", Captures: []string{"1"}},
+				{Key: "Statement[Sid=AllowS3].Effect", Value: "Allow", Captures: []string{"AllowS3"}},
+			},
+		},
+		{
+			pattern: "Statement[0:1].*",
+			expected: []Match{
+				{Key: "Statement[Sid=AllowS3].Effect", Value: "Allow", Captures: []string{"AllowS3", "Effect"}},
+				{Key: "Statement[Sid=AllowS3].Sid", Value: "AllowS3", Captures: []string{"AllowS3", "Sid"}},
+			},
+		},
+		{
+			pattern: "Statement[Sid=Allow*].Effect",
+			expected: []Match{
+				{Key: "Statement[Sid=AllowS3].Effect", Value: "Allow", Captures: []string{"AllowS3"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := Query(flat, test.pattern, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %+v, expected: %+v", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package goflat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+)
+
+var errTrailingData = errors.New("unexpected data after top-level value")
+
+// `FlatReader` flattens the JSON document read from r, passing each leaf to
+// sink as soon as it is decoded so the whole document is never held in
+// memory. The walk stops at the first error returned by sink, which is
+// returned as-is; errors returned by hooks are returned once the whole
+// document has been read. SortKeys has no effect since leaves are emitted in
+// document order.
+func FlatReader(r io.Reader, sink func(key string, value interface{}) error, config ...FlattenerConfig) error {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	var sinkErr error
+	f := newFlattener(cfg, func(key string, _ []pathSegment, value interface{}) bool {
+		sinkErr = sink(key, value)
+		return sinkErr == nil
+	})
+	if len(f.errs) > 0 {
+		return errors.Join(f.errs...)
+	}
+
+	input := &countingReader{r: r, lastNewline: -1}
+	dec := json.NewDecoder(input)
+	input.consumed = dec.InputOffset
+	if err := f.flattenTokens(dec, nil); err != nil {
+		return streamParseError(input, err)
+	}
+	if f.stopped {
+		return sinkErr
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errTrailingData
+		}
+		return streamParseError(input, &ParseError{Offset: dec.InputOffset(), Err: err})
+	}
+	if len(f.errs) > 0 {
+		return errors.Join(f.errs...)
+	}
+	return nil
+}
+
+// `countingReader` tracks how many bytes were read, whether the end of the
+// input was reached and where the lines start. Only the newlines after the
+// bytes consumed by the decoder are kept, since errors are found past them;
+// earlier ones are counted in lines.
+type countingReader struct {
+	r           io.Reader
+	read        int64
+	eof         bool
+	consumed    func() int64
+	lines       int
+	lastNewline int64
+	newlines    []int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.consumed != nil {
+		c.forget(c.consumed())
+	}
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.read+int64(i))
+		}
+	}
+	c.read += int64(n)
+	c.eof = c.eof || err == io.EOF
+	return n, err
+}
+
+// `forget` drops the newlines before offset, counting them in lines.
+func (c *countingReader) forget(offset int64) {
+	i := sort.Search(len(c.newlines), func(i int) bool { return c.newlines[i] >= offset })
+	if i == 0 {
+		return
+	}
+	c.lines += i
+	c.lastNewline = c.newlines[i-1]
+	c.newlines = append(c.newlines[:0], c.newlines[i:]...)
+}
+
+// `position` returns the 1-based line and column of an offset, as
+// `newParseError` does.
+func (c *countingReader) position(offset int64) (int, int) {
+	i := sort.Search(len(c.newlines), func(i int) bool { return c.newlines[i] >= offset })
+	lastNewline := c.lastNewline
+	if i > 0 {
+		lastNewline = c.newlines[i-1]
+	}
+	return c.lines + i + 1, int(offset - lastNewline - 1)
+}
+
+// `flattenTokens` flattens the next JSON value read from the decoder.
+func (f *flattener) flattenTokens(dec *json.Decoder, path []pathSegment) error {
+	if f.filter.prune(path) {
+		// Pruned subtrees are read without being decoded into values.
+		var skipped json.RawMessage
+		if err := dec.Decode(&skipped); err != nil {
+			return &ParseError{Offset: dec.InputOffset(), Err: err}
+		}
+		return nil
+	}
+	if f.atMaxDepth(path) || f.hookAt(path) != nil {
+		// Only the subtree below MaxDepth, or passed to a hook, is held in
+		// memory.
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return &ParseError{Offset: dec.InputOffset(), Err: err}
+		}
+		f.flatten(path, value)
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return &ParseError{Offset: dec.InputOffset(), Err: err}
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' && (f.config.ArrayMode != ArrayIndex || f.identityField(path) != "") {
+			return f.flattenTokenArray(dec, path)
+		}
+		if !dec.More() && f.config.EmptyContainers {
+			if t == '{' {
+				f.leaf(path, map[string]interface{}{})
+			} else {
+				f.leaf(path, []interface{}{})
+			}
+		}
+		// For each key-value pair or element, recursively flatten the nested structure.
+		for i := 0; dec.More() && !f.stopped; i++ {
+			segment := indexSegment(i)
+			if t == '{' {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return &ParseError{Offset: dec.InputOffset(), Err: err}
+				}
+				segment = nameSegment(keyTok.(string))
+			}
+			if err := f.flattenTokens(dec, append(path, segment)); err != nil {
+				return err
+			}
+		}
+		if f.stopped {
+			return nil
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return &ParseError{Offset: dec.InputOffset(), Err: err}
+		}
+	default:
+		// Optionally omitting empty or nil values based on the configuration.
+		if !f.omit(reflect.ValueOf(t)) {
+			f.leaf(path, t)
+		}
+	}
+	return nil
+}
+
+// `flattenTokenArray` flattens an array following the Keep, Join and Set
+// modes. Elements are decoded one at a time and buffered while they are
+// scalars; the first object or array switches back to index keys, so only
+// ArrayKeep and arrays keyed by an identity field are held in memory.
+func (f *flattener) flattenTokenArray(dec *json.Decoder, path []pathSegment) error {
+	keep := f.config.ArrayMode == ArrayKeep || f.identityField(path) != ""
+	buffered := []interface{}{}
+	indexed := false
+	for i := 0; dec.More() && !f.stopped; i++ {
+		var element interface{}
+		if err := dec.Decode(&element); err != nil {
+			return &ParseError{Offset: dec.InputOffset(), Err: err}
+		}
+		switch element.(type) {
+		case map[string]interface{}, []interface{}:
+			if !indexed && !keep {
+				indexed = true
+				for j, scalar := range buffered {
+					f.flatten(append(path, indexSegment(j)), scalar)
+				}
+				buffered = nil
+			}
+		}
+		if indexed {
+			f.flatten(append(path, indexSegment(i)), element)
+		} else {
+			buffered = append(buffered, element)
+		}
+	}
+	if f.stopped {
+		return nil
+	}
+	// Consume the closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return &ParseError{Offset: dec.InputOffset(), Err: err}
+	}
+	if !indexed {
+		f.flattenArray(path, buffered)
+	}
+	return nil
+}
+
+// `streamParseError` marks decoder errors caused by the input ending before
+// the document is complete; errors returned by the sink are left untouched.
+func streamParseError(input *countingReader, err error) error {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	var syntaxErr *json.SyntaxError
+	switch {
+	case parseErr.Err == io.EOF:
+		parseErr.Err = io.ErrUnexpectedEOF
+		parseErr.truncated = true
+	case errors.As(parseErr.Err, &syntaxErr):
+		parseErr.truncated = input.eof && syntaxErr.Offset >= input.read
+		parseErr.Offset = min(syntaxErr.Offset, input.read)
+		parseErr.Line, parseErr.Column = input.position(parseErr.Offset)
+	}
+	return parseErr
+}
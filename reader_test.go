@@ -0,0 +1,112 @@
+package goflat
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFlatReader(t *testing.T) {
+	input := `{"Records": [{"eventName": "GetObject", "userIdentity": {"type": "IAMUser", "arn": ""}}, {"eventName": "PutObject", "tags": null}]}`
+	config := FlattenerConfig{Prefix: "ct-", Separator: ".", OmitEmpty: true, OmitNil: true}
+
+	got := make(map[string]interface{})
+	err := FlatReader(strings.NewReader(input), func(key string, value interface{}) error {
+		got[key] = value
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected, err := FlatJSONToMap(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("mismatch, got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestFlatReaderSinkError(t *testing.T) {
+	errStop := errors.New("stop")
+	var keys []string
+	err := FlatReader(strings.NewReader(`[1, 2, 3, 4]`), func(key string, value interface{}) error {
+		keys = append(keys, key)
+		if len(keys) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected sink error, got: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"0", "1"}) {
+		t.Errorf("walk did not stop early, got keys: %v", keys)
+	}
+}
+
+func TestFlatReaderHookError(t *testing.T) {
+	errHook := errors.New("hook failed")
+	config := FlattenerConfig{Separator: ".", Hooks: map[string]FlatHook{
+		"Principal": func(prefix string, value interface{}, emit func(string, interface{})) error {
+			return errHook
+		},
+	}}
+	var keys []string
+	err := FlatReader(strings.NewReader(`{"Principal": "*", "Effect": "Allow"}`), func(key string, value interface{}) error {
+		keys = append(keys, key)
+		return nil
+	}, config)
+	var marshalerErr *MarshalerError
+	if !errors.As(err, &marshalerErr) || !errors.Is(err, errHook) {
+		t.Errorf("expected hook MarshalerError, got: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"Effect"}) {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestFlatReaderInvalidInput(t *testing.T) {
+	sink := func(key string, value interface{}) error { return nil }
+
+	err := FlatReader(strings.NewReader(`{"a": [1, 2`), sink)
+	if !errors.Is(err, ErrInvalidType) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected truncated ParseError, got: %v", err)
+	}
+
+	err = FlatReader(strings.NewReader(`{"a": 1} {"b": 2}`), sink)
+	if !errors.Is(err, ErrInvalidType) || errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected ParseError for trailing data, got: %v", err)
+	}
+}
+
+func TestFlatReaderErrorPosition(t *testing.T) {
+	sink := func(key string, value interface{}) error { return nil }
+	inputs := []string{
+		"{\n \"a\": 1,\n \"b\": x\n}",
+		"[\n" + strings.Repeat("  {\"id\": 1},\n", 2000) + "  {\"id\": ]\n]",
+		"{\"a\":\n\n  {\"b\": [1, 2,, 3]}}",
+	}
+	for _, input := range inputs {
+		_, err := FlatJSONToMap(input)
+		var expected *ParseError
+		if !errors.As(err, &expected) || expected.Line == 0 {
+			t.Fatalf("expected a ParseError with a position, got: %v", err)
+		}
+
+		for _, r := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+			err := FlatReader(r, sink)
+			var got *ParseError
+			if !errors.As(err, &got) {
+				t.Fatalf("expected a ParseError, got: %v", err)
+			}
+			if got.Offset != expected.Offset || got.Line != expected.Line || got.Column != expected.Column {
+				t.Errorf("position mismatch, got: %d %d:%d, expected: %d %d:%d", got.Offset, got.Line, got.Column, expected.Offset, expected.Line, expected.Column)
+			}
+		}
+	}
+}
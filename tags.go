@@ -0,0 +1,197 @@
+package goflat
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// `tagOptions` holds the options parsed from a `flat` or `json` struct tag.
+type tagOptions struct {
+	named     bool
+	omitEmpty bool
+	omitZero  bool
+	inline    bool
+	nested    bool
+}
+
+// `fieldKey` returns the key segment of a struct field and its tag options.
+// The `flat` tag takes precedence over the `json` tag; a field tagged with
+// "-" is skipped.
+func fieldKey(field reflect.StructField) (string, tagOptions, bool) {
+	tag, ok := field.Tag.Lookup("flat")
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "", tagOptions{}, false
+	}
+
+	name, rest, hasOptions := strings.Cut(tag, ",")
+	var opts tagOptions
+	for _, opt := range strings.Split(rest, ",") {
+		switch opt {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "omitzero":
+			opts.omitZero = true
+		case "inline":
+			opts.inline = true
+		case "nested":
+			opts.nested = true
+		}
+	}
+	if name == "" && ok {
+		// `flat` tags without a name keep the name from the `json` tag.
+		name, _, hasOptions = strings.Cut(field.Tag.Get("json"), ",")
+	}
+	// Only the exact tag "-" skips a field; as in encoding/json, `-,` names
+	// the key "-".
+	opts.named = name != "" && (name != "-" || hasOptions)
+	if !opts.named {
+		name = field.Name
+	}
+	return name, opts, true
+}
+
+// `flatField` is a field of a struct as seen by FlatStruct, reached from the
+// struct through the fields at index. Inline fields that are not structs,
+// such as maps, keep an empty name and are flattened at the level of the
+// struct.
+type flatField struct {
+	name  string
+	index []int
+	opts  tagOptions
+}
+
+// `fieldCache` maps struct types to their `typeFields`.
+var fieldCache sync.Map
+
+// `typeFields` returns the fields of a struct type, in declaration order,
+// with the fields of embedded structs promoted as `encoding/json` does:
+// anonymous struct fields without a tag name, and fields tagged `inline`,
+// are replaced by their own fields unless tagged `nested`. When several
+// fields share a name the shallowest one wins, then the one with a tag
+// name; the others are dropped along with ties.
+func typeFields(typ reflect.Type) []flatField {
+	if cached, ok := fieldCache.Load(typ); ok {
+		return cached.([]flatField)
+	}
+
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []flatField
+	visited := map[reflect.Type]bool{}
+	next := []embedded{{typ: typ}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		level := map[reflect.Type]bool{}
+		for _, e := range current {
+			if visited[e.typ] {
+				// Embedding a type already seen at a shallower depth adds
+				// nothing that is not hidden by the first one.
+				continue
+			}
+			level[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				name, opts, ok := fieldKey(sf)
+				if !ok {
+					continue
+				}
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if !sf.IsExported() && (!sf.Anonymous || ft.Kind() != reflect.Struct) {
+					continue
+				}
+
+				index := append(e.index[:len(e.index):len(e.index)], i)
+				if ft.Kind() == reflect.Struct && !opts.nested && (opts.inline || (sf.Anonymous && !opts.named)) {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				if opts.inline {
+					name = ""
+				}
+				fields = append(fields, flatField{name: name, index: index, opts: opts})
+			}
+		}
+		for t := range level {
+			visited[t] = true
+		}
+	}
+
+	fields = dominantFields(fields)
+	cached, _ := fieldCache.LoadOrStore(typ, fields)
+	return cached.([]flatField)
+}
+
+// `dominantFields` drops the fields hidden by others with the same name and
+// returns the rest sorted by index.
+func dominantFields(fields []flatField) []flatField {
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].opts.named && !fields[j].opts.named
+	})
+
+	kept := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		first := fields[i]
+		switch {
+		case first.name == "" || j == i+1:
+			// Inline fields without a name never conflict.
+			kept = append(kept, fields[i:j]...)
+		case len(fields[i+1].index) != len(first.index) || fields[i+1].opts.named != first.opts.named:
+			kept = append(kept, first)
+		}
+		i = j
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		a, b := kept[i].index, kept[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return kept
+}
+
+// `fieldByIndex` returns the field of a struct at index, false when it sits
+// behind a nil embedded pointer. With alloc set nil pointers are allocated
+// instead.
+func fieldByIndex(val reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				if !alloc || !val.CanSet() {
+					return reflect.Value{}, false
+				}
+				val.Set(reflect.New(val.Type().Elem()))
+			}
+			val = val.Elem()
+		}
+		val = val.Field(x)
+	}
+	return val, true
+}
@@ -0,0 +1,131 @@
+package goflat
+
+import (
+	"reflect"
+	"testing"
+)
+
+type embeddedUser struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type embeddedAudit struct {
+	Email   string `json:"email"`
+	Created string `json:"created"`
+	Owner   string
+}
+
+type embeddedOwner struct {
+	Owner string
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	type Admin struct {
+		embeddedUser
+		*embeddedAudit
+		embeddedOwner
+		Level int `json:"level"`
+	}
+	type Tagged struct {
+		User `json:"user"`
+		Role string `json:"role"`
+	}
+	type Nested struct {
+		*User `flat:",nested"`
+		Role  string `json:"role"`
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:  "promoted",
+			input: Admin{embeddedUser: embeddedUser{Username: "jane", Email: "jane@example.com"}, Level: 3},
+			// `email` and `Owner` are found at the same depth in two embedded
+			// structs with the same tagging, so they are dropped.
+			expected: map[string]interface{}{"username": "jane", "level": 3},
+		},
+		{
+			name: "shallowest wins",
+			input: struct {
+				Admin
+				Email string `json:"email"`
+			}{Admin: Admin{embeddedAudit: &embeddedAudit{Created: "2024"}}, Email: "root@example.com"},
+			expected: map[string]interface{}{"username": "", "created": "2024", "level": 0, "email": "root@example.com"},
+		},
+		{
+			name:     "tag name",
+			input:    Tagged{User: User{Username: "jane"}, Role: "admin"},
+			expected: map[string]interface{}{"user.Username": "jane", "user.Email": "", "role": "admin"},
+		},
+		{
+			name:     "nested",
+			input:    Nested{User: &User{Username: "jane"}, Role: "admin"},
+			expected: map[string]interface{}{"User.Username": "jane", "User.Email": "", "role": "admin"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FlatStruct(test.input, FlattenerConfig{Separator: "."})
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestEmbeddedFieldsTagDominance(t *testing.T) {
+	type Named struct {
+		Email string `json:"email"`
+	}
+	type Plain struct {
+		Email string
+	}
+	type Account struct {
+		Named
+		Plain `json:",omitempty"`
+	}
+
+	fields := typeFields(reflect.TypeOf(Account{}))
+	if len(fields) != 2 || fields[0].name != "email" || fields[1].name != "Email" {
+		t.Fatalf("unexpected fields: %+v", fields)
+	}
+
+	type Conflict struct {
+		Named
+		Other struct {
+			Email string `json:"email"`
+		} `flat:",inline"`
+		Plain
+	}
+	fields = typeFields(reflect.TypeOf(Conflict{}))
+	if len(fields) != 1 || fields[0].name != "Email" {
+		t.Errorf("unexpected fields: %+v", fields)
+	}
+}
+
+func TestEmbeddedFieldsUnflattenInto(t *testing.T) {
+	type Admin struct {
+		*User
+		embeddedOwner
+		Level int `json:"level"`
+	}
+
+	var admin Admin
+	err := UnflattenInto(map[string]interface{}{"Username": "jane", "Owner": "ops", "level": 3}, &admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Admin{User: &User{Username: "jane"}, embeddedOwner: embeddedOwner{Owner: "ops"}, Level: 3}
+	if !reflect.DeepEqual(admin, expected) {
+		t.Errorf("mismatch, got: %+v, expected: %+v", admin, expected)
+	}
+
+	var empty Admin
+	if err := UnflattenInto(map[string]interface{}{"level": 1}, &empty); err != nil || empty.User != nil {
+		t.Errorf("embedded pointer allocated without fields: %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,525 @@
+package goflat
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrKeyConflict     = errors.New("conflicting flattened keys")
+	ErrInvalidTarget   = errors.New("target must be a non-nil pointer")
+	ErrUnknownField    = errors.New("no matching field")
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	errNotNumeric = errors.New("not a number")
+)
+
+// `maxArrayGap` is the largest number of missing indexes tolerated when a
+// node is rebuilt as an array; sparser nodes are rebuilt as objects instead.
+const maxArrayGap = 1024
+
+// `unflattenNode` is a node of the tree rebuilt from flattened keys; empty
+// holds the empty object or array stored at the node by EmptyContainers and
+// identities the identity segments of its children in insertion order.
+type unflattenNode struct {
+	key        string
+	value      interface{}
+	leaf       bool
+	empty      interface{}
+	children   map[string]*unflattenNode
+	identities []pathSegment
+	indexed    bool
+}
+
+// `Unflatten` rebuilds a nested structure from a map with flattened keys.
+func Unflatten(flat map[string]interface{}, config ...FlattenerConfig) (interface{}, error) {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root := &unflattenNode{indexed: true}
+	for _, key := range keys {
+		path, err := parseKey(key, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := root.insert(key, path, flat[key]); err != nil {
+			return nil, err
+		}
+	}
+	return root.build(), nil
+}
+
+// `UnflattenJSON` rebuilds a nested JSON string from a flattened JSON string.
+func UnflattenJSON(jsonStr string, config ...FlattenerConfig) (string, error) {
+	var flat map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &flat); err != nil {
+		return "", newParseError([]byte(jsonStr), err)
+	}
+
+	data, err := Unflatten(flat, config...)
+	if err != nil {
+		return "", err
+	}
+	nestedJSON, err := json.Marshal(data)
+	if err != nil {
+		return "", newParseError(nil, err)
+	}
+	return string(nestedJSON), nil
+}
+
+// `insert` stores a value in the tree following the given key segments.
+func (n *unflattenNode) insert(key string, segments []pathSegment, value interface{}) error {
+	if len(segments) == 0 {
+		if isEmptyContainer(value) && !n.leaf && n.empty == nil {
+			// Empty containers only set the type of the node.
+			n.key, n.empty = key, value
+			return nil
+		}
+		if n.leaf || n.empty != nil || len(n.children) > 0 {
+			return n.conflict(key)
+		}
+		n.key, n.value, n.leaf = key, value, true
+		return nil
+	}
+	if n.leaf {
+		return n.conflict(key)
+	}
+
+	if n.children == nil {
+		n.children = make(map[string]*unflattenNode)
+	}
+	segment := segments[0]
+	name := segment.name
+	if segment.identity != "" {
+		name = identityChild(segment)
+	}
+	child, ok := n.children[name]
+	if !ok {
+		child = &unflattenNode{key: key, indexed: true}
+		n.children[name] = child
+		if segment.identity != "" {
+			n.identities = append(n.identities, segment)
+		}
+	}
+	if !segment.isIndex {
+		n.indexed = false
+	}
+	return child.insert(key, segments[1:], value)
+}
+
+// `conflict` returns the error for a key that is both a leaf and a container.
+func (n *unflattenNode) conflict(key string) error {
+	return fmt.Errorf("%w: %q and %q", ErrKeyConflict, n.key, key)
+}
+
+// `identityChild` returns the child name of an identity segment, which is
+// never a numeric index.
+func identityChild(segment pathSegment) string {
+	return "[" + segment.identity + "=" + segment.name + "]"
+}
+
+// `build` converts the tree into maps and slices; nodes whose children are
+// all array indexes become arrays. Elements read from identity segments take
+// the free indexes in key order.
+func (n *unflattenNode) build() interface{} {
+	if n.leaf {
+		return n.value
+	}
+	if len(n.children) == 0 {
+		if _, ok := n.empty.([]interface{}); ok {
+			return []interface{}{}
+		}
+		return map[string]interface{}{}
+	}
+
+	_, isObject := n.empty.(map[string]interface{})
+	if n.indexed && !isObject {
+		maxIndex := -1
+		for segment := range n.children {
+			index, ok := parseIndex(segment)
+			if ok && index > maxIndex {
+				maxIndex = index
+			}
+		}
+		if maxIndex-len(n.children) < maxArrayGap {
+			arr := make([]interface{}, max(maxIndex+1, len(n.children)))
+			used := make([]bool, len(arr))
+			for segment, child := range n.children {
+				if index, ok := parseIndex(segment); ok {
+					arr[index], used[index] = child.build(), true
+				}
+			}
+			free := 0
+			for _, segment := range n.identities {
+				for used[free] {
+					free++
+				}
+				arr[free], used[free] = n.children[identityChild(segment)].build(), true
+				if elem, ok := arr[free].(map[string]interface{}); ok {
+					if _, ok := elem[segment.identity]; !ok {
+						elem[segment.identity] = segment.name
+					}
+				}
+			}
+			return arr
+		}
+	}
+
+	obj := make(map[string]interface{}, len(n.children))
+	for segment, child := range n.children {
+		obj[segment] = child.build()
+	}
+	return obj
+}
+
+// `isEmptyContainer` reports whether a value is an empty object or array.
+func isEmptyContainer(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// `parseIndex` reports whether a key segment is an array index.
+func parseIndex(segment string) (int, bool) {
+	if segment == "" || (len(segment) > 1 && segment[0] == '0') || segment[0] < '0' || segment[0] > '9' {
+		return 0, false
+	}
+	index, err := strconv.Atoi(segment)
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// `UnflattenInto` rebuilds a map with flattened keys into the value pointed
+// to by out, following the key scheme produced by FlatStruct.
+func UnflattenInto(flat map[string]interface{}, out interface{}, config ...FlattenerConfig) error {
+	cfg := defaultConfiguration()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return ErrInvalidTarget
+	}
+
+	data, err := Unflatten(flat, cfg)
+	if err != nil {
+		return err
+	}
+	return errors.Join(assignValue(target.Elem(), data, nil, cfg)...)
+}
+
+// `assignValue` stores src into dst converting types where it is safe, and
+// returns an error for each key that cannot be assigned.
+func assignValue(dst reflect.Value, src interface{}, path []pathSegment, config FlattenerConfig) []error {
+	if src == nil {
+		return nil
+	}
+	srcVal := reflect.ValueOf(src)
+	if srcVal.Type().AssignableTo(dst.Type()) {
+		dst.Set(srcVal)
+		return nil
+	}
+
+	fail := func(err error) []error {
+		return []error{&AssignError{Key: formatKey(path, config), Value: src, Type: dst.Type(), Err: err}}
+	}
+
+	// Leaves written with their own encoding are read back the same way.
+	if dst.Type() == durationType {
+		if text, ok := src.(string); ok {
+			d, err := time.ParseDuration(text)
+			if err != nil {
+				return fail(err)
+			}
+			dst.SetInt(int64(d))
+			return nil
+		}
+		if config.DurationFormat == DurationSeconds {
+			seconds, err := toFloat64(src)
+			if err != nil {
+				return fail(err)
+			}
+			dst.SetInt(int64(seconds * float64(time.Second)))
+			return nil
+		}
+	}
+	if text, ok := src.(string); ok {
+		if dst.Type() == timeType && config.TimeFormat != "" {
+			t, err := time.Parse(config.TimeFormat, text)
+			if err != nil {
+				return fail(err)
+			}
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		}
+		if u, ok := implementer(dst, textUnmarshalerType); ok {
+			if err := u.(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+				return fail(err)
+			}
+			return nil
+		}
+		if isByteSlice(dst.Type()) {
+			data, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return fail(err)
+			}
+			dst.SetBytes(data)
+			return nil
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), src, path, config)
+	case reflect.Struct:
+		obj, ok := src.(map[string]interface{})
+		if !ok {
+			return fail(nil)
+		}
+		var errs []error
+		for _, key := range sortedMapKeys(obj) {
+			field, ok := structField(dst, key)
+			if !ok {
+				errs = append(errs, &AssignError{Key: formatKey(append(path, nameSegment(key)), config), Value: obj[key], Type: dst.Type(), Err: ErrUnknownField})
+				continue
+			}
+			errs = append(errs, assignValue(field, obj[key], append(path, nameSegment(key)), config)...)
+		}
+		return errs
+	case reflect.Map:
+		return assignMap(dst, src, path, config)
+	case reflect.Slice, reflect.Array:
+		arr, ok := src.([]interface{})
+		if !ok {
+			return fail(nil)
+		}
+		if dst.Kind() == reflect.Slice && (dst.Len() < len(arr) || dst.IsNil()) {
+			grown := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+			reflect.Copy(grown, dst)
+			dst.Set(grown)
+		}
+		var errs []error
+		for i, item := range arr {
+			if item == nil {
+				// Missing indexes were never in the input.
+				continue
+			}
+			itemPath := append(path, indexSegment(i))
+			if i >= dst.Len() {
+				errs = append(errs, &AssignError{Key: formatKey(itemPath, config), Value: item, Type: dst.Type(), Err: ErrIndexOutOfRange})
+				continue
+			}
+			errs = append(errs, assignValue(dst.Index(i), item, itemPath, config)...)
+		}
+		return errs
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dst.SetString(v)
+			return nil
+		case map[string]interface{}, []interface{}:
+			// Nested JSON expanded from a string field; store it back as JSON.
+			js, err := json.Marshal(src)
+			if err != nil {
+				return fail(err)
+			}
+			dst.SetString(string(js))
+			return nil
+		}
+		return fail(nil)
+	case reflect.Bool:
+		switch v := src.(type) {
+		case bool:
+			dst.SetBool(v)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fail(err)
+			}
+			dst.SetBool(b)
+			return nil
+		}
+		return fail(nil)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(src)
+		if err != nil || dst.OverflowInt(n) {
+			return fail(err)
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := toUint64(src)
+		if err != nil || dst.OverflowUint(n) {
+			return fail(err)
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(src)
+		if err != nil || dst.OverflowFloat(f) {
+			return fail(err)
+		}
+		dst.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		if dst.NumMethod() == 0 {
+			dst.Set(srcVal)
+			return nil
+		}
+	}
+	return fail(nil)
+}
+
+// `assignMap` stores an object, or an array by index, into a map value.
+func assignMap(dst reflect.Value, src interface{}, path []pathSegment, config FlattenerConfig) []error {
+	var segments []pathSegment
+	var values []interface{}
+	switch v := src.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedMapKeys(v) {
+			segments = append(segments, nameSegment(key))
+			values = append(values, v[key])
+		}
+	case []interface{}:
+		for i, item := range v {
+			if item != nil {
+				segments = append(segments, indexSegment(i))
+				values = append(values, item)
+			}
+		}
+	default:
+		return []error{&AssignError{Key: formatKey(path, config), Value: src, Type: dst.Type()}}
+	}
+
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), len(segments)))
+	}
+	keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+	var errs []error
+	for i, segment := range segments {
+		keyPath := append(path, segment)
+		mapKey := reflect.New(keyType).Elem()
+		if keyErrs := assignValue(mapKey, segment.name, keyPath, config); len(keyErrs) > 0 {
+			errs = append(errs, keyErrs...)
+			continue
+		}
+		elem := reflect.New(elemType).Elem()
+		if existing := dst.MapIndex(mapKey); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if elemErrs := assignValue(elem, values[i], keyPath, config); len(elemErrs) > 0 {
+			errs = append(errs, elemErrs...)
+			continue
+		}
+		dst.SetMapIndex(mapKey, elem)
+	}
+	return errs
+}
+
+// `structField` returns the field of a struct matching a flattened key
+// segment using the same names as FlatStruct, falling back to a
+// case-insensitive match.
+func structField(val reflect.Value, name string) (reflect.Value, bool) {
+	if field, ok := findStructField(val, name, func(a, b string) bool { return a == b }); ok {
+		return field, true
+	}
+	return findStructField(val, name, strings.EqualFold)
+}
+
+// `findStructField` looks for the field whose key matches name among the
+// fields promoted by `typeFields`; nil embedded pointers on the way are
+// allocated only when the field is found behind them.
+func findStructField(val reflect.Value, name string, match func(a, b string) bool) (reflect.Value, bool) {
+	for _, info := range typeFields(val.Type()) {
+		if info.name != "" && match(info.name, name) {
+			return fieldByIndex(val, info.index, true)
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// `toInt64` converts a numeric or string value to int64 without losing precision.
+func toInt64(src interface{}) (int64, error) {
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return 0, strconv.ErrRange
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, strconv.ErrRange
+		}
+		return int64(f), nil
+	case reflect.String:
+		return strconv.ParseInt(v.String(), 10, 64)
+	}
+	return 0, errNotNumeric
+}
+
+// `toUint64` converts a numeric or string value to uint64 without losing precision.
+func toUint64(src interface{}) (uint64, error) {
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.String:
+		return strconv.ParseUint(v.String(), 10, 64)
+	}
+	n, err := toInt64(src)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, strconv.ErrRange
+	}
+	return uint64(n), nil
+}
+
+// `toFloat64` converts a numeric or string value to float64.
+func toFloat64(src interface{}) (float64, error) {
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(v.String(), 64)
+	}
+	return 0, errNotNumeric
+}
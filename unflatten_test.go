@@ -0,0 +1,189 @@
+package goflat
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnflatten(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    map[string]interface{}
+		config   FlattenerConfig
+		expected interface{}
+	}{
+		{
+			name:   "NestedObjects",
+			input:  map[string]interface{}{"a": "3", "b.c": true, "b.d.e": 1.0},
+			config: FlattenerConfig{Separator: "."},
+			expected: map[string]interface{}{
+				"a": "3",
+				"b": map[string]interface{}{"c": true, "d": map[string]interface{}{"e": 1.0}},
+			},
+		},
+		{
+			name:   "ArraysWithPrefixAndSeparator",
+			input:  map[string]interface{}{"x-0~a": "3", "x-1~C~0~c": 10.0, "x-1~C~1~d": 11.0},
+			config: FlattenerConfig{Prefix: "x-", Separator: "~"},
+			expected: []interface{}{
+				map[string]interface{}{"a": "3"},
+				map[string]interface{}{"C": []interface{}{
+					map[string]interface{}{"c": 10.0},
+					map[string]interface{}{"d": 11.0},
+				}},
+			},
+		},
+		{
+			name:     "SparseArray",
+			input:    map[string]interface{}{"a.0": "x", "a.2": "z"},
+			config:   FlattenerConfig{Separator: "."},
+			expected: map[string]interface{}{"a": []interface{}{"x", nil, "z"}},
+		},
+		{
+			name:     "NumericKeysMixedWithNames",
+			input:    map[string]interface{}{"a.0": "x", "a.b": "y"},
+			config:   FlattenerConfig{Separator: "."},
+			expected: map[string]interface{}{"a": map[string]interface{}{"0": "x", "b": "y"}},
+		},
+		{
+			name:     "Scalar",
+			input:    map[string]interface{}{"": "x"},
+			config:   FlattenerConfig{Separator: "."},
+			expected: "x",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Unflatten(test.input, test.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatch, got: %v, expected: %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestUnflattenConflict(t *testing.T) {
+	_, err := Unflatten(map[string]interface{}{"a": 1, "a.b": 2})
+	if !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("expected ErrKeyConflict, got: %v", err)
+	}
+}
+
+func TestUnflattenJSONRoundTrip(t *testing.T) {
+	input := `[{"UserName":"s3-operator","InlinePolicies":[{"PolicyName":"policy-s3-operator","Statement":[{"Effect":"Allow","Action":["s3:ListBucket","s3:GetBucketLocation"],"Resource":["arn:aws:s3:::personal-s3-bucket/*"]}]}]}]`
+	config := FlattenerConfig{Separator: "."}
+
+	flat, err := FlatJSON(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnflattenJSON(flat, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotData, expectedData interface{}
+	if err := json.Unmarshal([]byte(got), &gotData); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(input), &expectedData); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotData, expectedData) {
+		t.Errorf("round trip mismatch, got: %s, expected: %s", got, input)
+	}
+}
+
+func TestUnflattenInto(t *testing.T) {
+	flat := map[string]interface{}{
+		"Name":                    "Admins",
+		"Members.0.User.Username": "john_doe",
+		"Members.0.User.Email":    "john@example.com",
+		"Members.0.Role":          "Admin",
+		"Members.0.Active":        "true",
+		"Members.1.User.Username": "jane_doe",
+		"Members.1.Active":        false,
+	}
+
+	var group Group
+	if err := UnflattenInto(flat, &group); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Group{
+		Name: "Admins",
+		Members: []*Member{
+			{User: &User{Username: "john_doe", Email: "john@example.com"}, Role: "Admin", Active: true},
+			{User: &User{Username: "jane_doe"}, Active: false},
+		},
+	}
+	if !reflect.DeepEqual(group, expected) {
+		t.Errorf("mismatch, got: %+v, expected: %+v", group, expected)
+	}
+}
+
+func TestUnflattenIntoConversions(t *testing.T) {
+	type Target struct {
+		Count  int64
+		Ratio  float32
+		Small  uint8
+		Labels map[string]int
+		IDs    []int
+		Fixed  [1]int
+	}
+
+	flat := map[string]interface{}{
+		"Count":      float64(42),
+		"Ratio":      "0.5",
+		"Small":      float64(300),
+		"Labels.a":   float64(1),
+		"Labels.b":   1.5,
+		"IDs.0":      float64(7),
+		"Fixed.3":    float64(1),
+		"Unknown":    "x",
+		"Count.Deep": nil,
+	}
+
+	var target Target
+	err := UnflattenInto(flat, &target)
+	if !errors.Is(err, ErrKeyConflict) {
+		t.Fatalf("expected ErrKeyConflict, got: %v", err)
+	}
+
+	delete(flat, "Count.Deep")
+	err = UnflattenInto(flat, &target)
+	if err == nil {
+		t.Fatal("expected assignment errors")
+	}
+
+	var failed []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var assignErr *AssignError
+		if !errors.As(e, &assignErr) {
+			t.Fatalf("unexpected error type: %T", e)
+		}
+		failed = append(failed, assignErr.Key)
+	}
+	expectedFailed := []string{"Fixed.3", "Labels.b", "Small", "Unknown"}
+	if !reflect.DeepEqual(failed, expectedFailed) {
+		t.Errorf("failed keys mismatch, got: %v, expected: %v", failed, expectedFailed)
+	}
+
+	expected := Target{Count: 42, Ratio: 0.5, Labels: map[string]int{"a": 1}, IDs: []int{7}}
+	if !reflect.DeepEqual(target, expected) {
+		t.Errorf("mismatch, got: %+v, expected: %+v", target, expected)
+	}
+}
+
+func TestUnflattenIntoInvalidTarget(t *testing.T) {
+	var group Group
+	if err := UnflattenInto(map[string]interface{}{}, group); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("expected ErrInvalidTarget, got: %v", err)
+	}
+}